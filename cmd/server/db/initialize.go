@@ -1,26 +1,29 @@
 package db
 
 import (
+	"github.com/fev0ks/UserServiceSC/pkg/config"
 	"github.com/fev0ks/UserServiceSC/pkg/service/postgres"
 	migrate "github.com/rubenv/sql-migrate"
-	"log"
+	"go.uber.org/zap"
 )
 
 const (
-	migrationsDir = "migrations/postgres"
-	dbDialect     = "postgres"
+	dbDialect = "postgres"
 )
 
-func InitDataBase() {
-	log.Println("migrations are started")
+func InitDataBase(cfg config.DatabaseConfig, logger *zap.Logger) *postgres.Storage {
+	logger.Info("migrations are started", zap.String("dir", cfg.MigrationsDir))
 	migration := &migrate.FileMigrationSource{
-		Dir: migrationsDir,
+		Dir: cfg.MigrationsDir,
+	}
+	dbConnection, err := postgres.OpenDataBaseConnection(cfg)
+	if err != nil {
+		logger.Fatal("database connection open failed", zap.Error(err))
 	}
-	dbConnection := postgres.OpenDataBaseConnection()
 	countOfMigrations, err := migrate.Exec(dbConnection, dbDialect, migration, migrate.Up)
 	if err != nil {
-		log.Fatalln(err)
+		logger.Fatal("migrations failed", zap.Error(err))
 	}
-	postgres.StorageInstance = postgres.NewStorage(dbConnection)
-	log.Printf("migrations are finished, total count: %d", countOfMigrations)
+	logger.Info("migrations are finished", zap.Int("count", countOfMigrations))
+	return postgres.NewStorage(dbConnection, logger)
 }
@@ -1,36 +1,212 @@
 package main
 
 import (
+	"context"
 	"github.com/fev0ks/UserServiceSC/cmd/server/db"
 	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"github.com/fev0ks/UserServiceSC/pkg/config"
+	"github.com/fev0ks/UserServiceSC/pkg/gateway"
 	"github.com/fev0ks/UserServiceSC/pkg/service"
+	"github.com/fev0ks/UserServiceSC/pkg/service/auth"
+	"github.com/fev0ks/UserServiceSC/pkg/service/healthcheck"
+	"github.com/fev0ks/UserServiceSC/pkg/service/logging"
+	"github.com/fev0ks/UserServiceSC/pkg/service/memory"
+	"github.com/fev0ks/UserServiceSC/pkg/service/metrics"
+	"github.com/fev0ks/UserServiceSC/pkg/service/postgres"
+	"github.com/fev0ks/UserServiceSC/pkg/service/requestid"
+	"github.com/fev0ks/UserServiceSC/pkg/service/tracing"
 	_ "github.com/lib/pq"
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"log"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 const (
-	serverPort = ":8080"
-	network    = "tcp"
+	network     = "tcp"
+	metricsPath = "/metrics"
 )
 
 func main() {
-	log.Println("Starting...")
-	db.InitDataBase()
-	startServer()
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalln(err)
+	}
+	logger, err := logging.New(cfg.Log)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer logger.Sync()
+
+	logger.Info("Starting...")
+	repository, closeRepository := initRepository(cfg, logger)
+	defer closeRepository()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	runServer(ctx, cfg, repository, logger)
 }
 
-func startServer() {
-	log.Println("server is started")
-	server := grpc.NewServer()
-	grpcServer := &service.GRPCServer{}
+// userStorage is a UserService storage which reachability is reported by health service
+type userStorage interface {
+	service.UserRepository
+	healthcheck.Pinger
+}
+
+// initRepository returns storage selected by config and function to release its resources
+func initRepository(cfg *config.Config, logger *zap.Logger) (userStorage, func()) {
+	if cfg.Server.Storage == config.MemoryStorage {
+		logger.Warn("in-memory storage is used, data will be lost on restart")
+		return memory.NewStorage(logger), func() {}
+	}
+	storage := db.InitDataBase(cfg.Database, logger)
+	return storage, func() {
+		if err := postgres.CloseDataBaseConnection(storage.DB); err != nil {
+			logger.Error("database connection close failed", zap.Error(err))
+			return
+		}
+		logger.Info("database connection is closed")
+	}
+}
+
+// runServer serves gRPC and REST/JSON requests until ctx is done, then drains in-flight requests
+func runServer(ctx context.Context, appCfg *config.Config, repository userStorage, logger *zap.Logger) {
+	cfg := appCfg.Server
+	serverMetrics := metrics.New()
+	if storage, ok := repository.(*postgres.Storage); ok {
+		serverMetrics.RegisterDB(storage.DB)
+	}
+	tracerProvider, shutdownTracing, err := tracing.NewTracerProvider(ctx, appCfg.Tracing)
+	if err != nil {
+		logger.Fatal("tracer provider init failed", zap.Error(err))
+	}
+
+	unaryInterceptors := []grpc.UnaryServerInterceptor{
+		tracing.UnaryServerInterceptor(tracerProvider, tracing.Propagator()),
+		requestid.UnaryServerInterceptor(),
+		serverMetrics.UnaryServerInterceptor(),
+		logging.UnaryServerInterceptor(logger),
+	}
+	var streamInterceptors []grpc.StreamServerInterceptor
+	if appCfg.Auth.Enabled {
+		authenticator, err := auth.NewAuthenticator(appCfg.Auth)
+		if err != nil {
+			logger.Fatal("authenticator init failed", zap.Error(err))
+		}
+		unaryInterceptors = append(unaryInterceptors, authenticator.UnaryServerInterceptor())
+		streamInterceptors = append(streamInterceptors, authenticator.StreamServerInterceptor())
+		if appCfg.Auth.PolicyFile != "" {
+			policy, err := auth.LoadPolicy(appCfg.Auth.PolicyFile)
+			if err != nil {
+				logger.Fatal("authorization policy load failed", zap.Error(err))
+			}
+			unaryInterceptors = append(unaryInterceptors, policy.UnaryServerInterceptor())
+		} else {
+			logger.Warn("authorization policy is not set, every authenticated client is allowed to call any RPC")
+		}
+	} else {
+		logger.Warn("authentication is disabled, every client is allowed to call UserService")
+	}
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unaryInterceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+	)
+	grpcServer := service.NewGRPCServer(repository)
 	api.RegisterUserServiceServer(server, grpcServer)
-	listener, err := net.Listen(network, serverPort)
+
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	healthChecker := healthcheck.NewChecker(healthServer, repository, appCfg.Health.CheckInterval, appCfg.Health.CheckTimeout, logger)
+	go healthChecker.Run(ctx)
+
+	listener, err := net.Listen(network, cfg.ListenAddress)
 	if err != nil {
-		log.Fatalln(err)
+		logger.Fatal("listen failed", zap.String("address", cfg.ListenAddress), zap.Error(err))
 	}
-	if err := server.Serve(listener); err != nil {
-		log.Fatalln(err)
+
+	serveErr := make(chan error, 3)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+	logger.Info("server is started", zap.String("address", cfg.ListenAddress))
+
+	var gatewayServer, metricsServer *http.Server
+	if cfg.HTTPListenAddress != "" {
+		conn, err := grpc.Dial(cfg.ListenAddress, grpc.WithInsecure())
+		if err != nil {
+			logger.Fatal("gRPC dial failed", zap.Error(err))
+		}
+		defer conn.Close()
+		gatewayServer = startHTTPServer("REST gateway", cfg.HTTPListenAddress,
+			gateway.NewGateway(api.NewUserServiceClient(conn)), serveErr, logger)
+	}
+	if cfg.MetricsListenAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle(metricsPath, serverMetrics.Handler())
+		metricsServer = startHTTPServer("metrics", cfg.MetricsListenAddress, mux, serveErr, logger)
+	}
+
+	select {
+	case err := <-serveErr:
+		logger.Fatal("serve failed", zap.Error(err))
+	case <-ctx.Done():
+		logger.Info("shutdown signal is received")
+	}
+	healthChecker.Shutdown()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	shutdownHTTPServer(shutdownCtx, "REST gateway", gatewayServer, logger)
+	stopServer(shutdownCtx, server, logger)
+	shutdownHTTPServer(shutdownCtx, "metrics", metricsServer, logger)
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("tracer provider shutdown failed", zap.Error(err))
+	}
+}
+
+// startHTTPServer serves handler on address in background, serve failure is sent to serveErr
+func startHTTPServer(name, address string, handler http.Handler, serveErr chan<- error, logger *zap.Logger) *http.Server {
+	server := &http.Server{
+		Addr:    address,
+		Handler: handler,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			serveErr <- err
+		}
+	}()
+	logger.Info(name+" is started", zap.String("address", address))
+	return server
+}
+
+func shutdownHTTPServer(ctx context.Context, name string, server *http.Server, logger *zap.Logger) {
+	if server == nil {
+		return
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Warn(name+" is not drained", zap.Error(err))
+	}
+}
+
+// stopServer waits for in-flight RPCs to finish, all remaining RPCs are cancelled once ctx is done
+func stopServer(ctx context.Context, server *grpc.Server, logger *zap.Logger) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		logger.Info("server is stopped gracefully")
+	case <-ctx.Done():
+		logger.Warn("server is not drained in time, forcing stop")
+		server.Stop()
 	}
 }
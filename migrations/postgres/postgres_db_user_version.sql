@@ -0,0 +1,6 @@
+-- +migrate Up
+-- version of user for optimistic concurrency, incremented by every update
+ALTER TABLE "user" ADD COLUMN if not exists "version" bigint NOT NULL DEFAULT 1;
+
+-- +migrate Down
+ALTER TABLE "user" DROP COLUMN IF EXISTS "version";
@@ -0,0 +1,6 @@
+-- +migrate Up
+-- soft deleted users are kept with deleted_at until they are restored or purged
+ALTER TABLE "user" ADD COLUMN if not exists "deleted_at" timestamp;
+
+-- +migrate Down
+ALTER TABLE "user" DROP COLUMN IF EXISTS "deleted_at";
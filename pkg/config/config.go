@@ -0,0 +1,429 @@
+package config
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	PostgresStorage = "postgres"
+	MemoryStorage   = "memory"
+
+	JSONLogFormat    = "json"
+	ConsoleLogFormat = "console"
+
+	NoneTracingExporter   = "none"
+	StdoutTracingExporter = "stdout"
+	OTLPTracingExporter   = "otlp"
+
+	HS256Algorithm = "HS256"
+	RS256Algorithm = "RS256"
+
+	configPathEnv = "USER_SERVICE_CONFIG"
+)
+
+var logLevels = map[string]bool{
+	"debug": true,
+	"info":  true,
+	"warn":  true,
+	"error": true,
+}
+
+var sslModes = map[string]bool{
+	"disable":     true,
+	"allow":       true,
+	"prefer":      true,
+	"require":     true,
+	"verify-ca":   true,
+	"verify-full": true,
+}
+
+type Config struct {
+	Server   ServerConfig   `yaml:"server"`
+	Log      LogConfig      `yaml:"log"`
+	Health   HealthConfig   `yaml:"health"`
+	Tracing  TracingConfig  `yaml:"tracing"`
+	Auth     AuthConfig     `yaml:"auth"`
+	Database DatabaseConfig `yaml:"database"`
+}
+
+type ServerConfig struct {
+	ListenAddress        string        `yaml:"listen_address"`
+	HTTPListenAddress    string        `yaml:"http_listen_address"`
+	MetricsListenAddress string        `yaml:"metrics_listen_address"`
+	Storage              string        `yaml:"storage"`
+	ShutdownTimeout      time.Duration `yaml:"shutdown_timeout"`
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+type HealthConfig struct {
+	CheckInterval time.Duration `yaml:"check_interval"`
+	CheckTimeout  time.Duration `yaml:"check_timeout"`
+}
+
+type TracingConfig struct {
+	Exporter     string  `yaml:"exporter"`
+	OTLPEndpoint string  `yaml:"otlp_endpoint"`
+	SampleRatio  float64 `yaml:"sample_ratio"`
+}
+
+type AuthConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// JWTKeyFile is HS256 secret or PEM encoded RSA public key for RS256, depending on JWTAlgorithm
+	JWTKeyFile   string         `yaml:"jwt_key_file"`
+	JWTAlgorithm string         `yaml:"jwt_algorithm"`
+	JWKSFile     string         `yaml:"jwks_file"`
+	JWTIssuer    string         `yaml:"jwt_issuer"`
+	JWTAudience  string         `yaml:"jwt_audience"`
+	APIKeys      []APIKeyConfig `yaml:"api_keys"`
+	// PolicyFile grants RPCs to roles, every authenticated principal may call any RPC without it
+	PolicyFile string `yaml:"policy_file"`
+}
+
+// APIKeyConfig keeps only hex encoded SHA-256 of the key, so config does not disclose the key itself
+type APIKeyConfig struct {
+	Name   string   `yaml:"name"`
+	SHA256 string   `yaml:"sha256"`
+	Roles  []string `yaml:"roles"`
+}
+
+type DatabaseConfig struct {
+	Host          string `yaml:"host"`
+	Port          string `yaml:"port"`
+	User          string `yaml:"user"`
+	Password      string `yaml:"password"`
+	Name          string `yaml:"name"`
+	SSLMode       string `yaml:"sslmode"`
+	MigrationsDir string `yaml:"migrations_dir"`
+}
+
+// setting binds a single config value to its command-line flag and environment variable
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	set   func(cfg *Config, value string) error
+}
+
+func stringValue(field func(cfg *Config) *string) func(cfg *Config, value string) error {
+	return func(cfg *Config, value string) error {
+		*field(cfg) = value
+		return nil
+	}
+}
+
+func durationValue(field func(cfg *Config) *time.Duration) func(cfg *Config, value string) error {
+	return func(cfg *Config, value string) error {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*field(cfg) = duration
+		return nil
+	}
+}
+
+func floatValue(field func(cfg *Config) *float64) func(cfg *Config, value string) error {
+	return func(cfg *Config, value string) error {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*field(cfg) = parsed
+		return nil
+	}
+}
+
+func boolValue(field func(cfg *Config) *bool) func(cfg *Config, value string) error {
+	return func(cfg *Config, value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field(cfg) = parsed
+		return nil
+	}
+}
+
+var settings = []setting{
+	{"listen-address", "USER_SERVICE_LISTEN_ADDRESS", "gRPC listen address",
+		stringValue(func(cfg *Config) *string { return &cfg.Server.ListenAddress })},
+	{"http-listen-address", "USER_SERVICE_HTTP_LISTEN_ADDRESS", "REST/JSON gateway listen address, empty disables gateway",
+		stringValue(func(cfg *Config) *string { return &cfg.Server.HTTPListenAddress })},
+	{"metrics-listen-address", "USER_SERVICE_METRICS_LISTEN_ADDRESS", "Prometheus /metrics listen address, empty disables metrics",
+		stringValue(func(cfg *Config) *string { return &cfg.Server.MetricsListenAddress })},
+	{"storage", "USER_SERVICE_STORAGE", "storage backend: postgres or memory",
+		stringValue(func(cfg *Config) *string { return &cfg.Server.Storage })},
+	{"shutdown-timeout", "USER_SERVICE_SHUTDOWN_TIMEOUT", "time to drain in-flight RPCs before forced stop, e.g. 15s",
+		durationValue(func(cfg *Config) *time.Duration { return &cfg.Server.ShutdownTimeout })},
+	{"log-level", "USER_SERVICE_LOG_LEVEL", "log level: debug, info, warn or error",
+		stringValue(func(cfg *Config) *string { return &cfg.Log.Level })},
+	{"log-format", "USER_SERVICE_LOG_FORMAT", "log format: json or console",
+		stringValue(func(cfg *Config) *string { return &cfg.Log.Format })},
+	{"health-check-interval", "USER_SERVICE_HEALTH_CHECK_INTERVAL", "interval between storage health checks",
+		durationValue(func(cfg *Config) *time.Duration { return &cfg.Health.CheckInterval })},
+	{"health-check-timeout", "USER_SERVICE_HEALTH_CHECK_TIMEOUT", "time for storage to answer health check ping",
+		durationValue(func(cfg *Config) *time.Duration { return &cfg.Health.CheckTimeout })},
+	{"tracing-exporter", "USER_SERVICE_TRACING_EXPORTER", "tracing exporter: none, stdout or otlp",
+		stringValue(func(cfg *Config) *string { return &cfg.Tracing.Exporter })},
+	{"tracing-otlp-endpoint", "USER_SERVICE_TRACING_OTLP_ENDPOINT", "OTLP gRPC collector endpoint",
+		stringValue(func(cfg *Config) *string { return &cfg.Tracing.OTLPEndpoint })},
+	{"tracing-sample-ratio", "USER_SERVICE_TRACING_SAMPLE_RATIO", "ratio of sampled root traces 0..1, parent sampling decision is respected",
+		floatValue(func(cfg *Config) *float64 { return &cfg.Tracing.SampleRatio })},
+	{"auth-enabled", "USER_SERVICE_AUTH_ENABLED", "reject RPCs without valid JWT or API key",
+		boolValue(func(cfg *Config) *bool { return &cfg.Auth.Enabled })},
+	{"auth-jwt-key-file", "USER_SERVICE_AUTH_JWT_KEY_FILE", "HS256 secret or RS256 PEM public key file",
+		stringValue(func(cfg *Config) *string { return &cfg.Auth.JWTKeyFile })},
+	{"auth-jwt-algorithm", "USER_SERVICE_AUTH_JWT_ALGORITHM", "algorithm of jwt key file: HS256 or RS256",
+		stringValue(func(cfg *Config) *string { return &cfg.Auth.JWTAlgorithm })},
+	{"auth-jwks-file", "USER_SERVICE_AUTH_JWKS_FILE", "JWKS file with keys of JWT issuer",
+		stringValue(func(cfg *Config) *string { return &cfg.Auth.JWKSFile })},
+	{"auth-jwt-issuer", "USER_SERVICE_AUTH_JWT_ISSUER", "required iss claim of JWT, empty value accepts any issuer",
+		stringValue(func(cfg *Config) *string { return &cfg.Auth.JWTIssuer })},
+	{"auth-jwt-audience", "USER_SERVICE_AUTH_JWT_AUDIENCE", "required aud claim of JWT, empty value accepts any audience",
+		stringValue(func(cfg *Config) *string { return &cfg.Auth.JWTAudience })},
+	{"auth-policy-file", "USER_SERVICE_AUTH_POLICY_FILE", "YAML file granting UserService RPCs to roles",
+		stringValue(func(cfg *Config) *string { return &cfg.Auth.PolicyFile })},
+	{"db-host", "USER_SERVICE_DB_HOST", "postgres host",
+		stringValue(func(cfg *Config) *string { return &cfg.Database.Host })},
+	{"db-port", "USER_SERVICE_DB_PORT", "postgres port",
+		stringValue(func(cfg *Config) *string { return &cfg.Database.Port })},
+	{"db-user", "USER_SERVICE_DB_USER", "postgres user",
+		stringValue(func(cfg *Config) *string { return &cfg.Database.User })},
+	{"db-password", "USER_SERVICE_DB_PASSWORD", "postgres password",
+		stringValue(func(cfg *Config) *string { return &cfg.Database.Password })},
+	{"db-name", "USER_SERVICE_DB_NAME", "postgres database name",
+		stringValue(func(cfg *Config) *string { return &cfg.Database.Name })},
+	{"db-sslmode", "USER_SERVICE_DB_SSLMODE", "postgres sslmode",
+		stringValue(func(cfg *Config) *string { return &cfg.Database.SSLMode })},
+	{"migrations-dir", "USER_SERVICE_MIGRATIONS_DIR", "directory with postgres migrations",
+		stringValue(func(cfg *Config) *string { return &cfg.Database.MigrationsDir })},
+}
+
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			ListenAddress:        ":8080",
+			HTTPListenAddress:    ":8081",
+			MetricsListenAddress: ":9090",
+			Storage:              PostgresStorage,
+			ShutdownTimeout:      15 * time.Second,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: JSONLogFormat,
+		},
+		Health: HealthConfig{
+			CheckInterval: 5 * time.Second,
+			CheckTimeout:  time.Second,
+		},
+		Tracing: TracingConfig{
+			Exporter:     NoneTracingExporter,
+			OTLPEndpoint: "localhost:4317",
+			SampleRatio:  1,
+		},
+		Auth: AuthConfig{
+			JWTAlgorithm: HS256Algorithm,
+		},
+		Database: DatabaseConfig{
+			Host:          "localhost",
+			Port:          "5432",
+			User:          "user",
+			Password:      "password",
+			Name:          "user_service_db",
+			SSLMode:       "disable",
+			MigrationsDir: "migrations/postgres",
+		},
+	}
+}
+
+// Load builds Config from defaults, then config file, then environment variables and then command-line flags,
+// every next source overrides values of the previous one
+func Load(args []string) (*Config, error) {
+	flagSet := flag.NewFlagSet("server", flag.ContinueOnError)
+	configPath := flagSet.String("config", os.Getenv(configPathEnv),
+		fmt.Sprintf("path to YAML or JSON config file (env %s)", configPathEnv))
+	for _, s := range settings {
+		flagSet.String(s.flag, "", fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+	if err := flagSet.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	if *configPath != "" {
+		if err := cfg.loadFile(*configPath); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.env); ok {
+			if err := s.set(cfg, value); err != nil {
+				return nil, fmt.Errorf("env %s is invalid: %v", s.env, err)
+			}
+		}
+	}
+	var flagErr error
+	flagSet.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name && flagErr == nil {
+				if err := s.set(cfg, f.Value.String()); err != nil {
+					flagErr = fmt.Errorf("flag -%s is invalid: %v", s.flag, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile reads YAML config file, JSON is accepted as well since it is a subset of YAML
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file read failed: %v", err)
+	}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("config file '%s' parse failed: %v", path, err)
+	}
+	return nil
+}
+
+func (c *Config) Validate() error {
+	if _, _, err := net.SplitHostPort(c.Server.ListenAddress); err != nil {
+		return fmt.Errorf("server.listen_address is invalid: %v", err)
+	}
+	if c.Server.HTTPListenAddress != "" {
+		if _, _, err := net.SplitHostPort(c.Server.HTTPListenAddress); err != nil {
+			return fmt.Errorf("server.http_listen_address is invalid: %v", err)
+		}
+	}
+	if c.Server.MetricsListenAddress != "" {
+		if _, _, err := net.SplitHostPort(c.Server.MetricsListenAddress); err != nil {
+			return fmt.Errorf("server.metrics_listen_address is invalid: %v", err)
+		}
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		return fmt.Errorf("server.shutdown_timeout must be positive, shutdown_timeout = %v", c.Server.ShutdownTimeout)
+	}
+	if !logLevels[c.Log.Level] {
+		return fmt.Errorf("log.level must be one of debug, info, warn or error, level = '%s'", c.Log.Level)
+	}
+	if c.Log.Format != JSONLogFormat && c.Log.Format != ConsoleLogFormat {
+		return fmt.Errorf("log.format must be '%s' or '%s', format = '%s'", JSONLogFormat, ConsoleLogFormat, c.Log.Format)
+	}
+	if c.Health.CheckInterval <= 0 {
+		return fmt.Errorf("health.check_interval must be positive, check_interval = %v", c.Health.CheckInterval)
+	}
+	if c.Health.CheckTimeout <= 0 {
+		return fmt.Errorf("health.check_timeout must be positive, check_timeout = %v", c.Health.CheckTimeout)
+	}
+	if err := c.Tracing.Validate(); err != nil {
+		return err
+	}
+	if err := c.Auth.Validate(); err != nil {
+		return err
+	}
+	switch c.Server.Storage {
+	case PostgresStorage:
+		return c.Database.Validate()
+	case MemoryStorage:
+		return nil
+	default:
+		return fmt.Errorf("server.storage must be '%s' or '%s', storage = '%s'",
+			PostgresStorage, MemoryStorage, c.Server.Storage)
+	}
+}
+
+func (c *TracingConfig) Validate() error {
+	switch c.Exporter {
+	case NoneTracingExporter, StdoutTracingExporter:
+	case OTLPTracingExporter:
+		if c.OTLPEndpoint == "" {
+			return errors.New("tracing.otlp_endpoint is missed")
+		}
+	default:
+		return fmt.Errorf("tracing.exporter must be one of none, stdout or otlp, exporter = '%s'", c.Exporter)
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return fmt.Errorf("tracing.sample_ratio must be in range 0..1, sample_ratio = %v", c.SampleRatio)
+	}
+	return nil
+}
+
+func (c *AuthConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.JWTKeyFile == "" && c.JWKSFile == "" && len(c.APIKeys) == 0 {
+		return errors.New("auth.jwt_key_file, auth.jwks_file or auth.api_keys must be set when auth is enabled")
+	}
+	if c.JWTKeyFile != "" && c.JWKSFile != "" {
+		return errors.New("only one of auth.jwt_key_file and auth.jwks_file may be set")
+	}
+	if c.JWTKeyFile != "" && c.JWTAlgorithm != HS256Algorithm && c.JWTAlgorithm != RS256Algorithm {
+		return fmt.Errorf("auth.jwt_algorithm must be '%s' or '%s', jwt_algorithm = '%s'",
+			HS256Algorithm, RS256Algorithm, c.JWTAlgorithm)
+	}
+	for i, apiKey := range c.APIKeys {
+		if apiKey.Name == "" {
+			return fmt.Errorf("auth.api_keys[%d].name is missed", i)
+		}
+		if hash, err := hex.DecodeString(apiKey.SHA256); err != nil || len(hash) != 32 {
+			return fmt.Errorf("auth.api_keys[%d].sha256 must be hex encoded SHA-256 of the key, name = '%s'", i, apiKey.Name)
+		}
+	}
+	return nil
+}
+
+func (c *DatabaseConfig) Validate() error {
+	if c.Host == "" {
+		return errors.New("database.host is missed")
+	}
+	if port, err := strconv.Atoi(c.Port); err != nil || port <= 0 || port > 65535 {
+		return fmt.Errorf("database.port must be a number in range 1-65535, port = '%s'", c.Port)
+	}
+	if c.User == "" {
+		return errors.New("database.user is missed")
+	}
+	if c.Name == "" {
+		return errors.New("database.name is missed")
+	}
+	if !sslModes[c.SSLMode] {
+		return fmt.Errorf("database.sslmode is not supported, sslmode = '%s'", c.SSLMode)
+	}
+	if c.MigrationsDir == "" {
+		return errors.New("database.migrations_dir is missed")
+	}
+	return nil
+}
+
+// DataSourceName returns libpq keyword/value connection string, values are quoted so spaces, quotes and
+// backslashes of password and other values can not break it or add keywords
+func (c *DatabaseConfig) DataSourceName() string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		quoteDSNValue(c.Host), quoteDSNValue(c.Port), quoteDSNValue(c.User), quoteDSNValue(c.Password),
+		quoteDSNValue(c.Name), quoteDSNValue(c.SSLMode))
+}
+
+func quoteDSNValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testConfigFile = `
+server:
+  listen_address: ":9090"
+database:
+  host: db.local
+  user: fileUser
+  sslmode: require
+`
+
+func TestLoad_shouldApplySourcesInOrder_whenAllSourcesAreSet(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(configPath, []byte(testConfigFile), 0600))
+	setEnv(t, "USER_SERVICE_DB_USER", "envUser")
+	setEnv(t, "USER_SERVICE_DB_NAME", "envName")
+
+	cfg, err := Load([]string{"-config", configPath, "-db-name", "flagName"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, ":9090", cfg.Server.ListenAddress)
+	assert.Equal(t, PostgresStorage, cfg.Server.Storage)
+	assert.Equal(t, "db.local", cfg.Database.Host)
+	assert.Equal(t, "5432", cfg.Database.Port)
+	assert.Equal(t, "envUser", cfg.Database.User)
+	assert.Equal(t, "flagName", cfg.Database.Name)
+	assert.Equal(t, "require", cfg.Database.SSLMode)
+}
+
+func TestLoad_shouldReturnError_whenConfigIsNotValid(t *testing.T) {
+	testCases := []struct {
+		caseName         string
+		args             []string
+		expectedErrorMsg string
+	}{
+		{
+			caseName:         "Unknown storage",
+			args:             []string{"-storage", "mysql"},
+			expectedErrorMsg: "server.storage must be 'postgres' or 'memory', storage = 'mysql'",
+		},
+		{
+			caseName:         "Invalid db port",
+			args:             []string{"-db-port", "abc"},
+			expectedErrorMsg: "database.port must be a number in range 1-65535, port = 'abc'",
+		},
+		{
+			caseName:         "Invalid shutdown timeout",
+			args:             []string{"-shutdown-timeout", "abc"},
+			expectedErrorMsg: "flag -shutdown-timeout is invalid: time: invalid duration \"abc\"",
+		},
+		{
+			caseName:         "Invalid sslmode",
+			args:             []string{"-db-sslmode", "on"},
+			expectedErrorMsg: "database.sslmode is not supported, sslmode = 'on'",
+		},
+		{
+			caseName:         "Auth without credentials",
+			args:             []string{"-auth-enabled", "true"},
+			expectedErrorMsg: "auth.jwt_key_file, auth.jwks_file or auth.api_keys must be set when auth is enabled",
+		},
+		{
+			caseName:         "Invalid jwt algorithm",
+			args:             []string{"-auth-enabled", "true", "-auth-jwt-key-file", "secret", "-auth-jwt-algorithm", "none"},
+			expectedErrorMsg: "auth.jwt_algorithm must be 'HS256' or 'RS256', jwt_algorithm = 'none'",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			_, err := Load(tc.args)
+			assert.EqualError(t, err, tc.expectedErrorMsg)
+		})
+	}
+}
+
+func setEnv(t *testing.T, key, value string) {
+	assert.NoError(t, os.Setenv(key, value))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(key)
+	})
+}
+
+func TestDataSourceName_shouldQuoteValues(t *testing.T) {
+	cfg := DatabaseConfig{Host: "db.local", Port: "5432", User: "user", Password: `p a's\w sslmode=disable`,
+		Name: "users", SSLMode: "require"}
+
+	assert.Equal(t, `host='db.local' port='5432' user='user' password='p a\'s\\w sslmode=disable' dbname='users' sslmode='require'`,
+		cfg.DataSourceName())
+}
@@ -0,0 +1,318 @@
+package gateway
+
+import (
+	"context"
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	userPath = "/service-example/v1/user"
+	itemPath = "/service-example/v1/item"
+
+	metadataHeaderPrefix = "Grpc-Metadata-"
+)
+
+// forwardedHeaders are passed to gRPC server as metadata in addition to Grpc-Metadata-* headers
+var forwardedHeaders = []string{"Authorization", "X-Api-Key", "X-Request-Id", "Traceparent", "Tracestate"}
+
+// returnedHeaders are set in HTTP response from gRPC header metadata in addition to Grpc-Metadata-* headers
+var returnedHeaders = []string{"X-Request-Id"}
+
+var (
+	marshalOptions   = protojson.MarshalOptions{EmitUnpopulated: true}
+	unmarshalOptions = protojson.UnmarshalOptions{}
+)
+
+// Gateway transcodes HTTP/JSON requests into UserService RPCs according to google.api.http options of the proto
+type Gateway struct {
+	client api.UserServiceClient
+	mux    *http.ServeMux
+}
+
+func NewGateway(client api.UserServiceClient) *Gateway {
+	g := &Gateway{client: client, mux: http.NewServeMux()}
+	g.mux.HandleFunc(userPath, g.handleUsers)
+	g.mux.HandleFunc(userPath+"/", g.handleUser)
+	g.mux.HandleFunc(itemPath, g.handleItems)
+	g.mux.HandleFunc(itemPath+"/", g.handleItem)
+	return g
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mux.ServeHTTP(w, r)
+}
+
+// handleUsers serves collection path: POST creates user, GET lists users
+func (g *Gateway) handleUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		request := &api.CreateUserRequest{}
+		g.call(w, r, func(ctx context.Context, opts ...grpc.CallOption) (proto.Message, error) {
+			if err := readBody(r, request); err != nil {
+				return nil, err
+			}
+			return g.client.CreateUser(ctx, request, opts...)
+		})
+	case http.MethodGet:
+		request := &api.ListUserRequest{}
+		g.call(w, r, func(ctx context.Context, opts ...grpc.CallOption) (proto.Message, error) {
+			if err := populateQueryParameters(request, r.URL.Query()); err != nil {
+				return nil, err
+			}
+			return g.client.ListUser(ctx, request, opts...)
+		})
+	default:
+		writeError(w, status.Errorf(codes.Unimplemented, "method %s is not allowed for %s", r.Method, r.URL.Path))
+	}
+}
+
+// handleUser serves single user path /{id}: GET returns, PUT updates and DELETE removes user
+func (g *Gateway) handleUser(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, userPath+"/")
+	if i := strings.Index(id, "/"); i > 0 {
+		g.handleUserItems(w, r, id[:i], id[i+1:])
+		return
+	}
+	if id == "" || strings.Contains(id, "/") {
+		writeError(w, status.Errorf(codes.NotFound, "path %s is not found", r.URL.Path))
+		return
+	}
+	if i := strings.LastIndex(id, ":"); i >= 0 {
+		g.handleUserMethod(w, r, id[:i], id[i+1:])
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		request := &api.GetUserRequest{Id: id}
+		g.call(w, r, func(ctx context.Context, opts ...grpc.CallOption) (proto.Message, error) {
+			return g.client.GetUser(ctx, request, opts...)
+		})
+	case http.MethodPut:
+		request := &api.UpdateUserRequest{}
+		g.call(w, r, func(ctx context.Context, opts ...grpc.CallOption) (proto.Message, error) {
+			if err := readBody(r, request); err != nil {
+				return nil, err
+			}
+			request.Id = id
+			return g.client.UpdateUser(ctx, request, opts...)
+		})
+	case http.MethodDelete:
+		request := &api.DeleteUserRequest{}
+		g.call(w, r, func(ctx context.Context, opts ...grpc.CallOption) (proto.Message, error) {
+			if err := populateQueryParameters(request, r.URL.Query()); err != nil {
+				return nil, err
+			}
+			request.Id = id
+			return g.client.DeleteUser(ctx, request, opts...)
+		})
+	default:
+		writeError(w, status.Errorf(codes.Unimplemented, "method %s is not allowed for %s", r.Method, r.URL.Path))
+	}
+}
+
+// handleUserMethod serves custom methods /{id}:restore and /{id}:purge
+func (g *Gateway) handleUserMethod(w http.ResponseWriter, r *http.Request, id string, method string) {
+	if r.Method != http.MethodPost {
+		writeError(w, status.Errorf(codes.Unimplemented, "method %s is not allowed for %s", r.Method, r.URL.Path))
+		return
+	}
+	switch method {
+	case "restore":
+		request := &api.RestoreUserRequest{}
+		g.call(w, r, func(ctx context.Context, opts ...grpc.CallOption) (proto.Message, error) {
+			if err := readBody(r, request); err != nil {
+				return nil, err
+			}
+			request.Id = id
+			return g.client.RestoreUser(ctx, request, opts...)
+		})
+	case "purge":
+		request := &api.PurgeUserRequest{}
+		g.call(w, r, func(ctx context.Context, opts ...grpc.CallOption) (proto.Message, error) {
+			if err := readBody(r, request); err != nil {
+				return nil, err
+			}
+			request.Id = id
+			return g.client.PurgeUser(ctx, request, opts...)
+		})
+	default:
+		writeError(w, status.Errorf(codes.NotFound, "path %s is not found", r.URL.Path))
+	}
+}
+
+// handleUserItems serves items of user: POST /{user_id}/items adds and POST /{user_id}/items:remove removes items
+func (g *Gateway) handleUserItems(w http.ResponseWriter, r *http.Request, userId string, path string) {
+	if path != "items" && path != "items:remove" {
+		writeError(w, status.Errorf(codes.NotFound, "path %s is not found", r.URL.Path))
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, status.Errorf(codes.Unimplemented, "method %s is not allowed for %s", r.Method, r.URL.Path))
+		return
+	}
+	if path == "items" {
+		request := &api.AddItemsRequest{}
+		g.call(w, r, func(ctx context.Context, opts ...grpc.CallOption) (proto.Message, error) {
+			if err := readBody(r, request); err != nil {
+				return nil, err
+			}
+			request.UserId = userId
+			return g.client.AddItems(ctx, request, opts...)
+		})
+		return
+	}
+	request := &api.RemoveItemsRequest{}
+	g.call(w, r, func(ctx context.Context, opts ...grpc.CallOption) (proto.Message, error) {
+		if err := readBody(r, request); err != nil {
+			return nil, err
+		}
+		request.UserId = userId
+		return g.client.RemoveItems(ctx, request, opts...)
+	})
+}
+
+// handleItems serves item collection path: GET lists items
+func (g *Gateway) handleItems(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, status.Errorf(codes.Unimplemented, "method %s is not allowed for %s", r.Method, r.URL.Path))
+		return
+	}
+	request := &api.ListItemsRequest{}
+	g.call(w, r, func(ctx context.Context, opts ...grpc.CallOption) (proto.Message, error) {
+		if err := populateQueryParameters(request, r.URL.Query()); err != nil {
+			return nil, err
+		}
+		return g.client.ListItems(ctx, request, opts...)
+	})
+}
+
+// handleItem serves single item path /{id}: GET returns item
+func (g *Gateway) handleItem(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, itemPath+"/")
+	if id == "" || strings.Contains(id, "/") {
+		writeError(w, status.Errorf(codes.NotFound, "path %s is not found", r.URL.Path))
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, status.Errorf(codes.Unimplemented, "method %s is not allowed for %s", r.Method, r.URL.Path))
+		return
+	}
+	request := &api.GetItemRequest{Id: id}
+	g.call(w, r, func(ctx context.Context, opts ...grpc.CallOption) (proto.Message, error) {
+		return g.client.GetItem(ctx, request, opts...)
+	})
+}
+
+type rpcCall func(ctx context.Context, opts ...grpc.CallOption) (proto.Message, error)
+
+func (g *Gateway) call(w http.ResponseWriter, r *http.Request, rpc rpcCall) {
+	var header metadata.MD
+	ctx := metadata.NewOutgoingContext(r.Context(), incomingMetadata(r))
+	response, err := rpc(ctx, grpc.Header(&header))
+	writeHeaderMetadata(w, header)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeMessage(w, http.StatusOK, response)
+}
+
+func readBody(r *http.Request, message proto.Message) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "request body read failed: %v", err)
+	}
+	if len(body) == 0 {
+		return nil
+	}
+	if err := unmarshalOptions.Unmarshal(body, message); err != nil {
+		return status.Errorf(codes.InvalidArgument, "request body is not valid: %v", err)
+	}
+	return nil
+}
+
+func incomingMetadata(r *http.Request) metadata.MD {
+	md := metadata.MD{}
+	for _, name := range forwardedHeaders {
+		if values := r.Header.Values(name); len(values) > 0 {
+			md.Append(strings.ToLower(name), values...)
+		}
+	}
+	for name, values := range r.Header {
+		if strings.HasPrefix(name, metadataHeaderPrefix) {
+			md.Append(strings.ToLower(strings.TrimPrefix(name, metadataHeaderPrefix)), values...)
+		}
+	}
+	return md
+}
+
+func writeHeaderMetadata(w http.ResponseWriter, header metadata.MD) {
+	for _, name := range returnedHeaders {
+		if values := header.Get(name); len(values) > 0 {
+			w.Header().Set(name, values[0])
+		}
+	}
+	for key, values := range header {
+		if key == "content-type" {
+			continue
+		}
+		for _, value := range values {
+			w.Header().Add(metadataHeaderPrefix+key, value)
+		}
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	writeMessage(w, httpStatusFromCode(st.Code()), st.Proto())
+}
+
+func writeMessage(w http.ResponseWriter, httpStatus int, message proto.Message) {
+	body, err := marshalOptions.Marshal(message)
+	if err != nil {
+		httpStatus = http.StatusInternalServerError
+		body = []byte(`{"code": 13, "message": "response marshal failed"}`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	_, _ = w.Write(body)
+}
+
+// httpStatusFromCode follows https://github.com/googleapis/googleapis/blob/master/google/rpc/code.proto
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
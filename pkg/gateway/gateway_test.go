@@ -0,0 +1,204 @@
+package gateway
+
+import (
+	"context"
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"github.com/fev0ks/UserServiceSC/pkg/service"
+	"github.com/fev0ks/UserServiceSC/pkg/service/memory"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const bufSize = 1024 * 1024
+
+func newTestGateway(t *testing.T) *httptest.Server {
+	lis := bufconn.Listen(bufSize)
+	server := grpc.NewServer()
+	api.RegisterUserServiceServer(server, service.NewGRPCServer(memory.NewStorage(zap.NewNop())))
+	go func() {
+		if err := server.Serve(lis); err != nil {
+			log.Fatalf("Server exited with error: %v", err)
+		}
+	}()
+	conn, err := grpc.DialContext(context.Background(), "", grpc.WithInsecure(),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return lis.Dial()
+		}))
+	assert.NoError(t, err)
+	httpServer := httptest.NewServer(NewGateway(api.NewUserServiceClient(conn)))
+	t.Cleanup(func() {
+		httpServer.Close()
+		conn.Close()
+		server.Stop()
+	})
+	return httpServer
+}
+
+func TestGateway_shouldTranscodeUserRequests(t *testing.T) {
+	httpServer := newTestGateway(t)
+
+	status, body := doRequest(t, http.MethodPost, httpServer.URL+userPath,
+		`{"name": "testName", "age": 123, "userType": "EMPLOYEE_USER_TYPE", "items": [{"name": "Im item #1"}]}`)
+	assert.Equal(t, http.StatusOK, status)
+	createdUser := &api.User{}
+	assert.NoError(t, protojson.Unmarshal(body, createdUser))
+	assert.NotEmpty(t, createdUser.Id)
+	assert.Equal(t, 1, len(createdUser.Items))
+
+	status, body = doRequest(t, http.MethodPut, httpServer.URL+userPath+"/"+createdUser.Id,
+		`{"name": "updatedName", "age": 999, "items": [{"id": "`+createdUser.Items[0].Id+`", "name": "updatedItem"}]}`)
+	assert.Equal(t, http.StatusOK, status)
+	updatedUser := &api.User{}
+	assert.NoError(t, protojson.Unmarshal(body, updatedUser))
+	assert.Equal(t, createdUser.Id, updatedUser.Id)
+	assert.Equal(t, "updatedName", updatedUser.Name)
+	assert.Equal(t, "updatedItem", updatedUser.Items[0].Name)
+	assert.Equal(t, int64(2), updatedUser.Version)
+
+	status, body = doRequest(t, http.MethodGet, httpServer.URL+userPath+"?page_filter.limit=10&pageFilter.page=1", "")
+	assert.Equal(t, http.StatusOK, status)
+	users := &api.ListUserResponse{}
+	assert.NoError(t, protojson.Unmarshal(body, users))
+	assert.Equal(t, 1, len(users.Users))
+
+	status, _ = doRequest(t, http.MethodDelete, httpServer.URL+userPath+"/"+createdUser.Id+"?version=1", "")
+	assert.Equal(t, http.StatusConflict, status)
+
+	status, _ = doRequest(t, http.MethodDelete, httpServer.URL+userPath+"/"+createdUser.Id+"?version=2", "")
+	assert.Equal(t, http.StatusOK, status)
+
+	status, _ = doRequest(t, http.MethodGet, httpServer.URL+userPath+"/"+createdUser.Id, "")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestGateway_shouldRestoreAndPurgeDeletedUser(t *testing.T) {
+	httpServer := newTestGateway(t)
+
+	status, body := doRequest(t, http.MethodPost, httpServer.URL+userPath, `{"name": "testName", "age": 123}`)
+	assert.Equal(t, http.StatusOK, status)
+	createdUser := &api.User{}
+	assert.NoError(t, protojson.Unmarshal(body, createdUser))
+	userUrl := httpServer.URL + userPath + "/" + createdUser.Id
+
+	status, _ = doRequest(t, http.MethodPost, userUrl+":purge", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = doRequest(t, http.MethodDelete, userUrl, "")
+	assert.Equal(t, http.StatusOK, status)
+
+	status, body = doRequest(t, http.MethodGet, httpServer.URL+userPath+"?include_deleted=true", "")
+	assert.Equal(t, http.StatusOK, status)
+	users := &api.ListUserResponse{}
+	assert.NoError(t, protojson.Unmarshal(body, users))
+	assert.Equal(t, 1, len(users.Users))
+	assert.NotNil(t, users.Users[0].DeletedAt)
+
+	status, body = doRequest(t, http.MethodPost, userUrl+":restore", `{"version": 2}`)
+	assert.Equal(t, http.StatusOK, status)
+	restoredUser := &api.User{}
+	assert.NoError(t, protojson.Unmarshal(body, restoredUser))
+	assert.Nil(t, restoredUser.DeletedAt)
+	assert.Equal(t, int64(3), restoredUser.Version)
+
+	status, _ = doRequest(t, http.MethodDelete, userUrl, "")
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = doRequest(t, http.MethodPost, userUrl+":purge", "")
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = doRequest(t, http.MethodPost, userUrl+":restore", "")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, _ = doRequest(t, http.MethodPost, userUrl+":unknown", "")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestGateway_shouldTranscodeItemRequests(t *testing.T) {
+	httpServer := newTestGateway(t)
+
+	status, body := doRequest(t, http.MethodPost, httpServer.URL+userPath, `{"name": "testName", "age": 123}`)
+	assert.Equal(t, http.StatusOK, status)
+	createdUser := &api.User{}
+	assert.NoError(t, protojson.Unmarshal(body, createdUser))
+
+	status, body = doRequest(t, http.MethodPost, httpServer.URL+userPath+"/"+createdUser.Id+"/items",
+		`{"items": [{"name": "Im item #1"}, {"name": "Im item #2"}]}`)
+	assert.Equal(t, http.StatusOK, status)
+	added := &api.AddItemsResponse{}
+	assert.NoError(t, protojson.Unmarshal(body, added))
+	assert.Equal(t, 2, len(added.Items))
+
+	status, body = doRequest(t, http.MethodGet, httpServer.URL+itemPath+"/"+added.Items[0].Id, "")
+	assert.Equal(t, http.StatusOK, status)
+	item := &api.Item{}
+	assert.NoError(t, protojson.Unmarshal(body, item))
+	assert.Equal(t, "Im item #1", item.Name)
+
+	status, _ = doRequest(t, http.MethodPost, httpServer.URL+userPath+"/"+createdUser.Id+"/items:remove",
+		`{"itemIds": ["`+added.Items[0].Id+`"]}`)
+	assert.Equal(t, http.StatusOK, status)
+
+	status, body = doRequest(t, http.MethodGet, httpServer.URL+itemPath+"?user_id="+createdUser.Id+"&page_size=10", "")
+	assert.Equal(t, http.StatusOK, status)
+	items := &api.ListItemsResponse{}
+	assert.NoError(t, protojson.Unmarshal(body, items))
+	assert.Equal(t, 1, len(items.Items))
+	assert.Equal(t, added.Items[1].Id, items.Items[0].Id)
+
+	status, _ = doRequest(t, http.MethodGet, httpServer.URL+userPath+"/"+createdUser.Id+"/unknown", "")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestGateway_shouldReturnBadRequest_whenRequestIsNotValid(t *testing.T) {
+	httpServer := newTestGateway(t)
+	testCases := []struct {
+		caseName string
+		method   string
+		url      string
+		body     string
+	}{
+		{
+			caseName: "Malformed body",
+			method:   http.MethodPost,
+			url:      httpServer.URL + userPath,
+			body:     `{"name": `,
+		},
+		{
+			caseName: "Unknown query parameter",
+			method:   http.MethodGet,
+			url:      httpServer.URL + userPath + "?unknown=1",
+		},
+		{
+			caseName: "Validation failed",
+			method:   http.MethodGet,
+			url:      httpServer.URL + userPath + "?page_filter.limit=1&page_filter.page=0",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.caseName, func(t *testing.T) {
+			status, body := doRequest(t, tc.method, tc.url, tc.body)
+			assert.Equal(t, http.StatusBadRequest, status)
+			assert.Contains(t, string(body), `"code":3`)
+		})
+	}
+}
+
+func doRequest(t *testing.T, method, url, body string) (int, []byte) {
+	request, err := http.NewRequest(method, url, strings.NewReader(body))
+	assert.NoError(t, err)
+	response, err := http.DefaultClient.Do(request)
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	responseBody, err := io.ReadAll(response.Body)
+	assert.NoError(t, err)
+	return response.StatusCode, responseBody
+}
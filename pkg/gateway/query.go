@@ -0,0 +1,114 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const timestampFullName = "google.protobuf.Timestamp"
+
+// populateQueryParameters sets message fields from query parameters, nested fields are addressed by dot separated
+// path, e.g. page_filter.limit=10 or pageFilter.limit=10
+func populateQueryParameters(message proto.Message, values url.Values) error {
+	for key, fieldValues := range values {
+		if err := populateField(message.ProtoReflect(), strings.Split(key, "."), fieldValues); err != nil {
+			return status.Errorf(codes.InvalidArgument, "query parameter '%s' is not valid: %v", key, err)
+		}
+	}
+	return nil
+}
+
+func populateField(message protoreflect.Message, path []string, values []string) error {
+	field := findField(message.Descriptor(), path[0])
+	if field == nil {
+		return fmt.Errorf("field '%s' is not found in %s", path[0], message.Descriptor().FullName())
+	}
+	if len(path) > 1 {
+		if field.Message() == nil || field.IsList() || field.IsMap() {
+			return fmt.Errorf("field '%s' is not a message", path[0])
+		}
+		return populateField(message.Mutable(field).Message(), path[1:], values)
+	}
+	if field.IsMap() {
+		return fmt.Errorf("map field '%s' is not supported", path[0])
+	}
+	if field.IsList() {
+		list := message.Mutable(field).List()
+		for _, value := range values {
+			parsed, err := parseValue(field, value)
+			if err != nil {
+				return err
+			}
+			list.Append(parsed)
+		}
+		return nil
+	}
+	parsed, err := parseValue(field, values[len(values)-1])
+	if err != nil {
+		return err
+	}
+	message.Set(field, parsed)
+	return nil
+}
+
+func findField(message protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	if field := message.Fields().ByName(protoreflect.Name(name)); field != nil {
+		return field
+	}
+	return message.Fields().ByJSONName(name)
+}
+
+func parseValue(field protoreflect.FieldDescriptor, value string) (protoreflect.Value, error) {
+	switch field.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(value), nil
+	case protoreflect.BoolKind:
+		parsed, err := strconv.ParseBool(value)
+		return protoreflect.ValueOfBool(parsed), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		parsed, err := strconv.ParseInt(value, 10, 32)
+		return protoreflect.ValueOfInt32(int32(parsed)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		return protoreflect.ValueOfInt64(parsed), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		parsed, err := strconv.ParseUint(value, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(parsed)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		return protoreflect.ValueOfUint64(parsed), err
+	case protoreflect.FloatKind:
+		parsed, err := strconv.ParseFloat(value, 32)
+		return protoreflect.ValueOfFloat32(float32(parsed)), err
+	case protoreflect.DoubleKind:
+		parsed, err := strconv.ParseFloat(value, 64)
+		return protoreflect.ValueOfFloat64(parsed), err
+	case protoreflect.BytesKind:
+		parsed, err := base64.URLEncoding.DecodeString(value)
+		return protoreflect.ValueOfBytes(parsed), err
+	case protoreflect.EnumKind:
+		if enumValue := field.Enum().Values().ByName(protoreflect.Name(value)); enumValue != nil {
+			return protoreflect.ValueOfEnum(enumValue.Number()), nil
+		}
+		parsed, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("'%s' is not a value of %s", value, field.Enum().FullName())
+		}
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(parsed)), nil
+	case protoreflect.MessageKind:
+		if field.Message().FullName() == timestampFullName {
+			parsed, err := time.Parse(time.RFC3339Nano, value)
+			return protoreflect.ValueOfMessage(timestamppb.New(parsed).ProtoReflect()), err
+		}
+	}
+	return protoreflect.Value{}, fmt.Errorf("type of field '%s' is not supported", field.Name())
+}
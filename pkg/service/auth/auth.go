@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/fev0ks/UserServiceSC/pkg/config"
+	"github.com/fev0ks/UserServiceSC/pkg/service/errorhandler"
+	"github.com/golang-jwt/jwt/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"strings"
+)
+
+const (
+	AuthorizationKey = "authorization"
+	APIKeyKey        = "x-api-key"
+
+	JWTMethod    = "jwt"
+	APIKeyMethod = "api_key"
+
+	bearerPrefix = "bearer "
+)
+
+// publicServices are served without credentials, e.g. health is checked by orchestrator
+var publicServices = []string{"/grpc.health.v1.Health/"}
+
+// Principal is an authenticated caller of RPC
+type Principal struct {
+	// Subject is sub claim of JWT or name of API key
+	Subject string
+	Roles   []string
+	// Method is JWTMethod or APIKeyMethod
+	Method string
+}
+
+type contextKey struct{}
+
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, principal)
+}
+
+// FromContext returns principal of ctx or nil if ctx is not authenticated
+func FromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(contextKey{}).(*Principal)
+	return principal
+}
+
+// claims are JWT claims used by Authenticator, roles claim is optional
+type claims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles"`
+}
+
+// Authenticator checks bearer JWT from authorization metadata or API key from x-api-key metadata
+type Authenticator struct {
+	keys     keySet
+	issuer   string
+	audience string
+	// apiKeys are principals by hex encoded SHA-256 of the key
+	apiKeys map[string]*Principal
+}
+
+func NewAuthenticator(cfg config.AuthConfig) (*Authenticator, error) {
+	var keys keySet
+	var err error
+	switch {
+	case cfg.JWKSFile != "":
+		keys, err = loadJWKSFile(cfg.JWKSFile)
+	case cfg.JWTKeyFile != "":
+		keys, err = loadKeyFile(cfg.JWTKeyFile, cfg.JWTAlgorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	apiKeys := make(map[string]*Principal, len(cfg.APIKeys))
+	for _, apiKey := range cfg.APIKeys {
+		apiKeys[strings.ToLower(apiKey.SHA256)] = &Principal{Subject: apiKey.Name, Roles: apiKey.Roles, Method: APIKeyMethod}
+	}
+	return &Authenticator{
+		keys:     keys,
+		issuer:   cfg.JWTIssuer,
+		audience: cfg.JWTAudience,
+		apiKeys:  apiKeys,
+	}, nil
+}
+
+// Authenticate returns principal of credentials from incoming metadata of ctx, error has Unauthenticated code
+func (a *Authenticator) Authenticate(ctx context.Context) (*Principal, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(AuthorizationKey); len(values) > 0 {
+		if !strings.HasPrefix(strings.ToLower(values[0]), bearerPrefix) {
+			return nil, errorhandler.NewUnauthenticatedError("authorization must be a bearer token")
+		}
+		return a.authenticateToken(strings.TrimSpace(values[0][len(bearerPrefix):]))
+	}
+	if values := md.Get(APIKeyKey); len(values) > 0 {
+		return a.authenticateAPIKey(values[0])
+	}
+	return nil, errorhandler.NewUnauthenticatedError("credentials are missed, bearer token or API key is expected")
+}
+
+func (a *Authenticator) authenticateToken(token string) (*Principal, error) {
+	if len(a.keys) == 0 {
+		return nil, errorhandler.NewUnauthenticatedError("bearer tokens are not accepted")
+	}
+	var tokenClaims claims
+	_, err := jwt.ParseWithClaims(token, &tokenClaims, a.keys.keyOf,
+		jwt.WithValidMethods([]string{config.HS256Algorithm, config.RS256Algorithm}))
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, errorhandler.NewUnauthenticatedError("bearer token is expired")
+	}
+	if err != nil {
+		return nil, errorhandler.NewUnauthenticatedError(fmt.Sprintf("bearer token is invalid: %v", err))
+	}
+	if a.issuer != "" && !tokenClaims.VerifyIssuer(a.issuer, true) {
+		return nil, errorhandler.NewUnauthenticatedError("bearer token is issued by unknown issuer")
+	}
+	if a.audience != "" && !tokenClaims.VerifyAudience(a.audience, true) {
+		return nil, errorhandler.NewUnauthenticatedError("bearer token is issued for another audience")
+	}
+	if tokenClaims.Subject == "" {
+		return nil, errorhandler.NewUnauthenticatedError("bearer token has no sub claim")
+	}
+	return &Principal{Subject: tokenClaims.Subject, Roles: tokenClaims.Roles, Method: JWTMethod}, nil
+}
+
+// authenticateAPIKey looks principal up by hash of the key, so time of the lookup does not depend on key itself
+func (a *Authenticator) authenticateAPIKey(apiKey string) (*Principal, error) {
+	hash := sha256.Sum256([]byte(apiKey))
+	principal, ok := a.apiKeys[hex.EncodeToString(hash[:])]
+	if !ok {
+		return nil, errorhandler.NewUnauthenticatedError("API key is invalid")
+	}
+	return principal, nil
+}
+
+// UnaryServerInterceptor rejects RPCs of non-public services without valid credentials
+// and puts principal into the context
+func (a *Authenticator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if isPublic(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		principal, err := a.Authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(NewContext(ctx, principal), req)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of UnaryServerInterceptor
+func (a *Authenticator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if isPublic(info.FullMethod) {
+			return handler(srv, stream)
+		}
+		principal, err := a.Authenticate(stream.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: stream, ctx: NewContext(stream.Context(), principal)})
+	}
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func isPublic(fullMethod string) bool {
+	for _, service := range publicServices {
+		if strings.HasPrefix(fullMethod, service) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/fev0ks/UserServiceSC/pkg/config"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	secret = "test-secret"
+	apiKey = "test-api-key"
+)
+
+var info = &grpc.UnaryServerInfo{FullMethod: "/user_service_sc.UserService/DeleteUser"}
+
+func writeFile(t *testing.T, name string, data string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0600))
+	return path
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, tokenClaims claims) string {
+	token := jwt.NewWithClaims(method, tokenClaims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	assert.NoError(t, err)
+	return signed
+}
+
+func validClaims() claims {
+	return claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "42",
+			Issuer:    "test-issuer",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Roles: []string{"admin"},
+	}
+}
+
+func newAuthenticator(t *testing.T) (*Authenticator, *rsa.PrivateKey) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	jwks := fmt.Sprintf(`{"keys": [
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": "%s", "e": "%s"},
+		{"kty": "oct", "kid": "hmac-1", "k": "%s"}
+	]}`,
+		base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+		base64.RawURLEncoding.EncodeToString([]byte(secret)))
+	hash := sha256.Sum256([]byte(apiKey))
+
+	authenticator, err := NewAuthenticator(config.AuthConfig{
+		Enabled:   true,
+		JWKSFile:  writeFile(t, "jwks.json", jwks),
+		JWTIssuer: "test-issuer",
+		APIKeys:   []config.APIKeyConfig{{Name: "admin-cli", SHA256: hex.EncodeToString(hash[:]), Roles: []string{"admin"}}},
+	})
+	assert.NoError(t, err)
+	return authenticator, rsaKey
+}
+
+func TestAuthenticator_Authenticate(t *testing.T) {
+	authenticator, rsaKey := newAuthenticator(t)
+	expiredClaims := validClaims()
+	expiredClaims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	foreignClaims := validClaims()
+	foreignClaims.Issuer = "another-issuer"
+
+	testCases := []struct {
+		caseName          string
+		md                metadata.MD
+		expectedPrincipal *Principal
+		expectedErrorMsg  string
+	}{
+		{
+			caseName:          "RS256 token",
+			md:                metadata.Pairs(AuthorizationKey, "Bearer "+signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, validClaims())),
+			expectedPrincipal: &Principal{Subject: "42", Roles: []string{"admin"}, Method: JWTMethod},
+		},
+		{
+			caseName:          "HS256 token",
+			md:                metadata.Pairs(AuthorizationKey, "bearer "+signToken(t, jwt.SigningMethodHS256, "hmac-1", []byte(secret), validClaims())),
+			expectedPrincipal: &Principal{Subject: "42", Roles: []string{"admin"}, Method: JWTMethod},
+		},
+		{
+			caseName:          "API key",
+			md:                metadata.Pairs(APIKeyKey, apiKey),
+			expectedPrincipal: &Principal{Subject: "admin-cli", Roles: []string{"admin"}, Method: APIKeyMethod},
+		},
+		{
+			caseName:         "Missed credentials",
+			md:               metadata.MD{},
+			expectedErrorMsg: "credentials are missed, bearer token or API key is expected",
+		},
+		{
+			caseName:         "Basic authorization",
+			md:               metadata.Pairs(AuthorizationKey, "Basic dXNlcjpwYXNzd29yZA=="),
+			expectedErrorMsg: "authorization must be a bearer token",
+		},
+		{
+			caseName:         "Expired token",
+			md:               metadata.Pairs(AuthorizationKey, "Bearer "+signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, expiredClaims)),
+			expectedErrorMsg: "bearer token is expired",
+		},
+		{
+			caseName:         "HS256 token signed by RSA public key",
+			md:               metadata.Pairs(AuthorizationKey, "Bearer "+signToken(t, jwt.SigningMethodHS256, "rsa-1", []byte(secret), validClaims())),
+			expectedErrorMsg: "bearer token is invalid: key 'rsa-1' does not accept HS256 signature",
+		},
+		{
+			caseName:         "Unknown kid",
+			md:               metadata.Pairs(AuthorizationKey, "Bearer "+signToken(t, jwt.SigningMethodHS256, "hmac-2", []byte(secret), validClaims())),
+			expectedErrorMsg: "bearer token is invalid: key 'hmac-2' is unknown",
+		},
+		{
+			caseName:         "Unknown issuer",
+			md:               metadata.Pairs(AuthorizationKey, "Bearer "+signToken(t, jwt.SigningMethodHS256, "hmac-1", []byte(secret), foreignClaims)),
+			expectedErrorMsg: "bearer token is issued by unknown issuer",
+		},
+		{
+			caseName:         "Invalid API key",
+			md:               metadata.Pairs(APIKeyKey, "another-key"),
+			expectedErrorMsg: "API key is invalid",
+		},
+	}
+
+	for i := range testCases {
+		tc := &testCases[i]
+		t.Run(tc.caseName, func(t *testing.T) {
+			principal, err := authenticator.Authenticate(metadata.NewIncomingContext(context.Background(), tc.md))
+			if tc.expectedErrorMsg != "" {
+				assert.Equal(t, codes.Unauthenticated, status.Code(err))
+				assert.Equal(t, tc.expectedErrorMsg, status.Convert(err).Message())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedPrincipal, principal)
+			}
+		})
+	}
+}
+
+func TestNewAuthenticator_shouldVerifyTokenByKeyFile(t *testing.T) {
+	authenticator, err := NewAuthenticator(config.AuthConfig{
+		Enabled:      true,
+		JWTKeyFile:   writeFile(t, "secret", secret+"\n"),
+		JWTAlgorithm: config.HS256Algorithm,
+	})
+	assert.NoError(t, err)
+	token := signToken(t, jwt.SigningMethodHS256, "", []byte(secret), validClaims())
+
+	principal, err := authenticator.Authenticate(metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs(AuthorizationKey, "Bearer "+token)))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "42", principal.Subject)
+}
+
+func TestUnaryServerInterceptor_shouldPutPrincipalIntoContext(t *testing.T) {
+	authenticator, _ := newAuthenticator(t)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(APIKeyKey, apiKey))
+	var handledPrincipal *Principal
+
+	_, err := authenticator.UnaryServerInterceptor()(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		handledPrincipal = FromContext(ctx)
+		return nil, nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "admin-cli", handledPrincipal.Subject)
+}
+
+func TestUnaryServerInterceptor_shouldRejectUnauthenticatedCall(t *testing.T) {
+	authenticator, _ := newAuthenticator(t)
+	handled := false
+
+	_, err := authenticator.UnaryServerInterceptor()(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		handled = true
+		return nil, nil
+	})
+
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.False(t, handled)
+}
+
+func TestUnaryServerInterceptor_shouldSkipHealthService(t *testing.T) {
+	authenticator, _ := newAuthenticator(t)
+	healthInfo := &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}
+
+	_, err := authenticator.UnaryServerInterceptor()(context.Background(), nil, healthInfo, func(ctx context.Context, req interface{}) (interface{}, error) {
+		assert.Nil(t, FromContext(ctx))
+		return nil, nil
+	})
+
+	assert.NoError(t, err)
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/fev0ks/UserServiceSC/pkg/config"
+	"github.com/golang-jwt/jwt/v4"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// verificationKey is HS256 secret or RS256 public key, token signed by another algorithm is rejected
+type verificationKey struct {
+	algorithm string
+	key       interface{}
+}
+
+// keySet is verification keys by kid, key without kid (e.g. of jwt_key_file) verifies tokens of any kid
+type keySet map[string]verificationKey
+
+// keyOf is jwt.Keyfunc, token without kid is verified by the only key of the set
+func (s keySet) keyOf(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s[kid]
+	if !ok {
+		key, ok = s[""]
+	}
+	if !ok && kid == "" && len(s) == 1 {
+		for _, single := range s {
+			key, ok = single, true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("key '%s' is unknown", kid)
+	}
+	if token.Method.Alg() != key.algorithm {
+		return nil, fmt.Errorf("key '%s' does not accept %s signature", kid, token.Method.Alg())
+	}
+	return key.key, nil
+}
+
+func loadKeyFile(path string, algorithm string) (keySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("jwt key file read failed: %v", err)
+	}
+	switch algorithm {
+	case config.HS256Algorithm:
+		secret := []byte(strings.TrimSpace(string(data)))
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("jwt key file '%s' is empty", path)
+		}
+		return keySet{"": {algorithm: algorithm, key: secret}}, nil
+	case config.RS256Algorithm:
+		publicKey, err := jwt.ParseRSAPublicKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key file '%s' parse failed: %v", path, err)
+		}
+		return keySet{"": {algorithm: algorithm, key: publicKey}}, nil
+	default:
+		return nil, fmt.Errorf("jwt algorithm '%s' is not supported", algorithm)
+	}
+}
+
+// jsonWebKey is a key of JWKS (RFC 7517), only RSA and symmetric signature keys are supported
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+func loadJWKSFile(path string) (keySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("jwks file read failed: %v", err)
+	}
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("jwks file '%s' parse failed: %v", path, err)
+	}
+	keys := make(keySet, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.verificationKey()
+		if err != nil {
+			return nil, fmt.Errorf("jwks file '%s' key '%s' is invalid: %v", path, jwk.Kid, err)
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("jwks file '%s' has no signature keys", path)
+	}
+	return keys, nil
+}
+
+func (k *jsonWebKey) verificationKey() (verificationKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return verificationKey{}, fmt.Errorf("n is invalid: %v", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return verificationKey{}, fmt.Errorf("e is invalid: %v", err)
+		}
+		publicKey := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return verificationKey{algorithm: config.RS256Algorithm, key: publicKey}, nil
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) == 0 {
+			return verificationKey{}, fmt.Errorf("k is invalid: %v", err)
+		}
+		return verificationKey{algorithm: config.HS256Algorithm, key: secret}, nil
+	default:
+		return verificationKey{}, fmt.Errorf("kty '%s' is not supported", k.Kty)
+	}
+}
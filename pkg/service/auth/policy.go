@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"github.com/fev0ks/UserServiceSC/pkg/service/errorhandler"
+	"github.com/fev0ks/UserServiceSC/pkg/service/rpcmethod"
+	"github.com/fev0ks/UserServiceSC/pkg/service/updatemask"
+	"google.golang.org/grpc"
+	"gopkg.in/yaml.v3"
+	"os"
+)
+
+// AnyMethod grants every RPC of UserService to the role
+const AnyMethod = "*"
+
+// Policy grants UserService RPCs to roles of principal, RPCs are named without service, e.g. GetUser
+type Policy struct {
+	// Roles are RPCs allowed for principal having the role
+	Roles map[string][]string `yaml:"roles"`
+	// Self are RPCs allowed for principal authenticated by JWT when sub claim equals to id of requested user,
+	// self UpdateUser must not change user_type
+	Self []string `yaml:"self"`
+}
+
+// LoadPolicy reads YAML policy file, RPCs which are not declared in UserService are rejected
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("policy file read failed: %v", err)
+	}
+	var policy Policy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("policy file '%s' parse failed: %v", path, err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("policy file '%s' is invalid: %v", path, err)
+	}
+	return &policy, nil
+}
+
+func (p *Policy) Validate() error {
+	for role, methods := range p.Roles {
+		for _, method := range methods {
+			if method != AnyMethod && !isUserServiceMethod(method) {
+				return fmt.Errorf("role '%s' has unknown RPC '%s'", role, method)
+			}
+		}
+	}
+	for _, method := range p.Self {
+		if !isUserServiceMethod(method) {
+			return fmt.Errorf("self has unknown RPC '%s'", method)
+		}
+	}
+	return nil
+}
+
+// Allows reports whether principal may call method with req
+func (p *Policy) Allows(principal *Principal, method string, req interface{}) bool {
+	for _, role := range principal.Roles {
+		for _, allowed := range p.Roles[role] {
+			if allowed == AnyMethod || allowed == method {
+				return true
+			}
+		}
+	}
+	if principal.Method != JWTMethod {
+		return false
+	}
+	for _, allowed := range p.Self {
+		if allowed == method && isSelf(principal, req) && !changesUserType(req) {
+			return true
+		}
+	}
+	return false
+}
+
+// UnaryServerInterceptor rejects RPCs of UserService which are not allowed for principal of the context,
+// so it has to be chained after Authenticator interceptor
+func (p *Policy) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		service, method := rpcmethod.Split(info.FullMethod)
+		if service != api.UserService_ServiceDesc.ServiceName {
+			return handler(ctx, req)
+		}
+		principal := FromContext(ctx)
+		if principal == nil {
+			return nil, errorhandler.NewUnauthenticatedError("credentials are missed, bearer token or API key is expected")
+		}
+		if !p.Allows(principal, method, req) {
+			return nil, errorhandler.NewPermissionDeniedError(
+				fmt.Sprintf("%s is not allowed for '%s'", method, principal.Subject))
+		}
+		return handler(ctx, req)
+	}
+}
+
+// isSelf reports whether req addresses the user which is principal itself, item requests address user by user_id
+func isSelf(principal *Principal, req interface{}) bool {
+	switch userRequest := req.(type) {
+	case *api.GetItemRequest:
+		// id of item is not id of its user
+		return false
+	case interface{ GetUserId() string }:
+		return userRequest.GetUserId() != "" && userRequest.GetUserId() == principal.Subject
+	case interface{ GetId() string }:
+		return userRequest.GetId() != "" && userRequest.GetId() == principal.Subject
+	}
+	return false
+}
+
+// changesUserType reports whether req is UpdateUser which may write user_type, a missing update_mask writes it too
+func changesUserType(req interface{}) bool {
+	updateRequest, ok := req.(*api.UpdateUserRequest)
+	if !ok {
+		return false
+	}
+	mask, err := updatemask.ParseUserMask(updateRequest.GetUpdateMask())
+	return err != nil || mask.UserType
+}
+
+func isUserServiceMethod(method string) bool {
+	for _, desc := range api.UserService_ServiceDesc.Methods {
+		if desc.MethodName == method {
+			return true
+		}
+	}
+	return false
+}
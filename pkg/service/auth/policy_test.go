@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"testing"
+)
+
+func userServiceInfo(method string) *grpc.UnaryServerInfo {
+	return &grpc.UnaryServerInfo{FullMethod: "/" + api.UserService_ServiceDesc.ServiceName + "/" + method}
+}
+
+func TestPolicy_UnaryServerInterceptor(t *testing.T) {
+	policy, err := LoadPolicy("../../../configs/policy.yaml")
+	assert.NoError(t, err)
+
+	admin := &Principal{Subject: "admin-cli", Roles: []string{"admin"}, Method: APIKeyMethod}
+	support := &Principal{Subject: "7", Roles: []string{"support"}, Method: JWTMethod}
+	reader := &Principal{Subject: "reporting", Roles: []string{"reader"}, Method: APIKeyMethod}
+	user := &Principal{Subject: "42", Method: JWTMethod}
+	apiKeyUser := &Principal{Subject: "42", Method: APIKeyMethod}
+
+	testCases := []struct {
+		caseName     string
+		principal    *Principal
+		method       string
+		req          interface{}
+		expectedCode codes.Code
+	}{
+		{"Admin deletes user", admin, "DeleteUser", &api.DeleteUserRequest{Id: "1"}, codes.OK},
+		{"Support updates user", support, "UpdateUser", &api.UpdateUserRequest{Id: "1"}, codes.OK},
+		{"Support deletes user", support, "DeleteUser", &api.DeleteUserRequest{Id: "1"}, codes.PermissionDenied},
+		{"Support restores user", support, "RestoreUser", &api.RestoreUserRequest{Id: "1"}, codes.OK},
+		{"Support purges user", support, "PurgeUser", &api.PurgeUserRequest{Id: "1"}, codes.PermissionDenied},
+		{"Reader lists users", reader, "ListUser", &api.ListUserRequest{}, codes.OK},
+		{"Reader updates user", reader, "UpdateUser", &api.UpdateUserRequest{Id: "1"}, codes.PermissionDenied},
+		{"User gets itself", user, "GetUser", &api.GetUserRequest{Id: "42"}, codes.OK},
+		{"User updates itself", user, "UpdateUser", &api.UpdateUserRequest{Id: "42",
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name", "age", "items"}}}, codes.OK},
+		{"User updates own user_type", user, "UpdateUser", &api.UpdateUserRequest{Id: "42",
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name", "user_type"}}}, codes.PermissionDenied},
+		{"User updates every field of itself", user, "UpdateUser", &api.UpdateUserRequest{Id: "42"}, codes.PermissionDenied},
+		{"User deletes itself", user, "DeleteUser", &api.DeleteUserRequest{Id: "42"}, codes.PermissionDenied},
+		{"User gets another user", user, "GetUser", &api.GetUserRequest{Id: "43"}, codes.PermissionDenied},
+		{"User adds its items", user, "AddItems", &api.AddItemsRequest{UserId: "42"}, codes.OK},
+		{"User lists items of another user", user, "ListItems", &api.ListItemsRequest{UserId: "43"}, codes.PermissionDenied},
+		{"User lists items of every user", user, "ListItems", &api.ListItemsRequest{}, codes.PermissionDenied},
+		{"User gets item with id of user", user, "GetItem", &api.GetItemRequest{Id: "42"}, codes.PermissionDenied},
+		{"API key named as user gets it", apiKeyUser, "GetUser", &api.GetUserRequest{Id: "42"}, codes.PermissionDenied},
+		{"Unauthenticated call", nil, "GetUser", &api.GetUserRequest{Id: "42"}, codes.Unauthenticated},
+	}
+
+	for i := range testCases {
+		tc := &testCases[i]
+		t.Run(tc.caseName, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.principal != nil {
+				ctx = NewContext(ctx, tc.principal)
+			}
+
+			_, err := policy.UnaryServerInterceptor()(ctx, tc.req, userServiceInfo(tc.method), func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, nil
+			})
+
+			assert.Equal(t, tc.expectedCode, status.Code(err))
+		})
+	}
+}
+
+func TestPolicy_Validate_shouldRejectUnknownMethod(t *testing.T) {
+	policy := &Policy{Roles: map[string][]string{"reader": {"GetUsers"}}}
+
+	assert.EqualError(t, policy.Validate(), "role 'reader' has unknown RPC 'GetUsers'")
+}
@@ -0,0 +1,46 @@
+package entityid
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var ErrIdIsMissed = errors.New("id is missed")
+
+// ID is a parsed id of user or item, ids are numeric bigserial values of postgres
+type ID struct {
+	value string
+}
+
+// Parse accepts canonical positive decimal ids only, so "007" and "+7" do not alias "7".
+// Other formats like UUID or ULID have to be recognized here as well once storages issue them.
+func Parse(value string) (ID, error) {
+	if value == "" {
+		return ID{}, ErrIdIsMissed
+	}
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || number <= 0 || strconv.FormatInt(number, 10) != value {
+		return ID{}, fmt.Errorf("'%s' is not a valid id", value)
+	}
+	return ID{value: value}, nil
+}
+
+// String returns id in the form stored in api messages
+func (id ID) String() string {
+	return id.value
+}
+
+// IsZero reports whether id is not set
+func (id ID) IsZero() bool {
+	return id.value == ""
+}
+
+// Strings returns ids in the form stored in api messages
+func Strings(ids []ID) []string {
+	values := make([]string, 0, len(ids))
+	for _, id := range ids {
+		values = append(values, id.String())
+	}
+	return values
+}
@@ -0,0 +1,38 @@
+package entityid
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		caseName string
+		value    string
+		errMsg   string
+	}{
+		{caseName: "numeric id", value: "12"},
+		{caseName: "max bigserial", value: "9223372036854775807"},
+		{caseName: "empty id", value: "", errMsg: "id is missed"},
+		{caseName: "not numeric", value: "abc", errMsg: "'abc' is not a valid id"},
+		{caseName: "zero", value: "0", errMsg: "'0' is not a valid id"},
+		{caseName: "negative", value: "-1", errMsg: "'-1' is not a valid id"},
+		{caseName: "leading zero", value: "07", errMsg: "'07' is not a valid id"},
+		{caseName: "plus sign", value: "+7", errMsg: "'+7' is not a valid id"},
+		{caseName: "out of bigint", value: "9223372036854775808", errMsg: "'9223372036854775808' is not a valid id"},
+	}
+
+	for i := range testCases {
+		tc := &testCases[i]
+		t.Run(tc.caseName, func(t *testing.T) {
+			id, err := Parse(tc.value)
+			if tc.errMsg == "" {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.value, id.String())
+			} else {
+				assert.EqualError(t, err, tc.errMsg)
+				assert.True(t, id.IsZero())
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package errorhandler
+
+import (
+	"context"
+	"errors"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+// sanitized messages of storage errors, raw errors may contain queries and data of other users
+const (
+	internalErrorMsg         = "internal error"
+	alreadyExistsErrorMsg    = "resource already exists"
+	foreignKeyErrorMsg       = "referenced resource does not exist"
+	serializationErrorMsg    = "concurrent update, retry the request"
+	deadlineExceededErrorMsg = "request timed out"
+	canceledErrorMsg         = "request is canceled"
+)
+
+// FromError keeps gRPC status of the error as is, postgres errors are mapped to gRPC codes by their SQLSTATE.
+// Client gets a sanitized message only, the storage error is kept as cause of returned error, so logging
+// interceptor writes it with LogFields into the single line of failed RPC
+func FromError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	code, msg := codeOf(err)
+	return &storageError{status: status.New(code, msg), cause: err}
+}
+
+// storageError is sanitized status returned to client, its cause is logged on the server side only
+type storageError struct {
+	status *status.Status
+	cause  error
+}
+
+func (e *storageError) Error() string {
+	return e.status.Err().Error()
+}
+
+func (e *storageError) GRPCStatus() *status.Status {
+	return e.status
+}
+
+func (e *storageError) Unwrap() error {
+	return e.cause
+}
+
+// LogFields returns details of storage error returned by FromError: the raw error and code, table and
+// constraint of postgres error; other errors have no fields
+func LogFields(err error) []zap.Field {
+	var storageErr *storageError
+	if !errors.As(err, &storageErr) {
+		return nil
+	}
+	fields := []zap.Field{zap.NamedError("cause", storageErr.cause)}
+	var pqErr *pq.Error
+	if errors.As(storageErr.cause, &pqErr) {
+		fields = append(fields,
+			zap.String("pq.code", string(pqErr.Code)),
+			zap.String("pq.table", pqErr.Table),
+			zap.String("pq.constraint", pqErr.Constraint))
+	}
+	return fields
+}
+
+func codeOf(err error) (codes.Code, string) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return codes.DeadlineExceeded, deadlineExceededErrorMsg
+	}
+	if errors.Is(err, context.Canceled) {
+		return codes.Canceled, canceledErrorMsg
+	}
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return codes.Internal, internalErrorMsg
+	}
+	switch pqErr.Code.Name() {
+	case "unique_violation":
+		return codes.AlreadyExists, alreadyExistsErrorMsg
+	case "foreign_key_violation":
+		return codes.FailedPrecondition, foreignKeyErrorMsg
+	case "serialization_failure":
+		return codes.Aborted, serializationErrorMsg
+	case "query_canceled":
+		// statement_timeout cancels the query on the server side, otherwise it is canceled by the client
+		if strings.Contains(pqErr.Message, "statement timeout") {
+			return codes.DeadlineExceeded, deadlineExceededErrorMsg
+		}
+		return codes.Canceled, canceledErrorMsg
+	default:
+		return codes.Internal, internalErrorMsg
+	}
+}
@@ -0,0 +1,104 @@
+package errorhandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestFromError(t *testing.T) {
+	testCases := []struct {
+		caseName string
+		err      error
+		code     codes.Code
+		msg      string
+	}{
+		{
+			caseName: "status is kept",
+			err:      NewUserNotFoundError("1"),
+			code:     codes.NotFound,
+			msg:      "User not found by id = 1",
+		},
+		{
+			caseName: "plain error is internal",
+			err:      errors.New("dial tcp 10.0.0.1:5432: connection reset"),
+			code:     codes.Internal,
+			msg:      "internal error",
+		},
+		{
+			caseName: "unique violation",
+			err:      &pq.Error{Code: "23505", Message: `duplicate key value violates unique constraint "item_pkey"`},
+			code:     codes.AlreadyExists,
+			msg:      "resource already exists",
+		},
+		{
+			caseName: "wrapped foreign key violation",
+			err:      fmt.Errorf("createItems: %w", &pq.Error{Code: "23503", Message: "insert or update on table \"item\""}),
+			code:     codes.FailedPrecondition,
+			msg:      "referenced resource does not exist",
+		},
+		{
+			caseName: "serialization failure",
+			err:      &pq.Error{Code: "40001", Message: "could not serialize access due to concurrent update"},
+			code:     codes.Aborted,
+			msg:      "concurrent update, retry the request",
+		},
+		{
+			caseName: "statement timeout",
+			err:      &pq.Error{Code: "57014", Message: "canceling statement due to statement timeout"},
+			code:     codes.DeadlineExceeded,
+			msg:      "request timed out",
+		},
+		{
+			caseName: "query canceled by client",
+			err:      &pq.Error{Code: "57014", Message: "canceling statement due to user request"},
+			code:     codes.Canceled,
+			msg:      "request is canceled",
+		},
+		{
+			caseName: "context deadline",
+			err:      context.DeadlineExceeded,
+			code:     codes.DeadlineExceeded,
+			msg:      "request timed out",
+		},
+		{
+			caseName: "syntax error is internal",
+			err:      &pq.Error{Code: "42601", Message: `syntax error at or near "from"`},
+			code:     codes.Internal,
+			msg:      "internal error",
+		},
+	}
+
+	for i := range testCases {
+		tc := &testCases[i]
+		t.Run(tc.caseName, func(t *testing.T) {
+			err := FromError(tc.err)
+			assert.Equal(t, tc.code, status.Code(err))
+			assert.Equal(t, tc.msg, status.Convert(err).Message())
+		})
+	}
+	assert.Nil(t, FromError(nil))
+}
+
+func TestLogFields_shouldReturnCauseOfStorageError(t *testing.T) {
+	err := FromError(&pq.Error{Code: "23505", Message: "duplicate key value", Table: "item", Constraint: "item_pkey"})
+
+	encoder := zapcore.NewMapObjectEncoder()
+	for _, field := range LogFields(err) {
+		field.AddTo(encoder)
+	}
+	assert.Equal(t, "pq: duplicate key value", encoder.Fields["cause"])
+	assert.Equal(t, "23505", encoder.Fields["pq.code"])
+	assert.Equal(t, "item", encoder.Fields["pq.table"])
+	assert.Equal(t, "item_pkey", encoder.Fields["pq.constraint"])
+	var pqErr *pq.Error
+	assert.True(t, errors.As(err, &pqErr))
+
+	assert.Empty(t, LogFields(NewUserNotFoundError("1")))
+}
@@ -1,19 +1,25 @@
 package errorhandler
 
 import (
+	"fmt"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
-	"log"
+	"strconv"
+	"strings"
 )
 
-func LogMsg(msg string) {
-	if msg != "" {
-		log.Printf("msg: %v", msg)
-	}
-}
+const (
+	errorDomain = "user_service_sc"
+
+	// VersionMismatchReason is the reason of google.rpc.ErrorInfo detail of a rejected stale write
+	VersionMismatchReason = "VERSION_MISMATCH"
+	// CurrentVersionKey is the metadata key of ErrorInfo with current version of the user
+	CurrentVersionKey = "current_version"
+)
 
+// NewStatusError does not log the error, failed RPC is logged once by logging interceptor
 func NewStatusError(code codes.Code, errorMsg string) error {
-	LogMsg(errorMsg)
 	return status.Error(code, errorMsg)
 }
 
@@ -28,3 +34,47 @@ func NewNotFoundError(msg string) error {
 func NewInternalError(msg string) error {
 	return NewStatusError(codes.Internal, msg)
 }
+
+func NewUnauthenticatedError(msg string) error {
+	return NewStatusError(codes.Unauthenticated, msg)
+}
+
+func NewPermissionDeniedError(msg string) error {
+	return NewStatusError(codes.PermissionDenied, msg)
+}
+
+func NewUserNotFoundError(userId string) error {
+	return NewNotFoundError(fmt.Sprintf("User not found by id = %s", userId))
+}
+
+func NewItemNotFoundError(itemId string) error {
+	return NewNotFoundError(fmt.Sprintf("Item not found by id = %s", itemId))
+}
+
+// NewItemsNotFoundError lists ids of items which do not belong to the user
+func NewItemsNotFoundError(userId string, itemIds []string) error {
+	return NewNotFoundError(fmt.Sprintf("Items not found for user %s: %s", userId, strings.Join(itemIds, ", ")))
+}
+
+func NewFailedPreconditionError(msg string) error {
+	return NewStatusError(codes.FailedPrecondition, msg)
+}
+
+func NewAbortedError(msg string) error {
+	return NewStatusError(codes.Aborted, msg)
+}
+
+// NewVersionMismatchError is ABORTED with the current version in message and in google.rpc.ErrorInfo detail
+func NewVersionMismatchError(userId string, version int64, currentVersion int64) error {
+	st := status.New(codes.Aborted,
+		fmt.Sprintf("version of user %s is %d, but %d is expected", userId, currentVersion, version))
+	withDetails, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   VersionMismatchReason,
+		Domain:   errorDomain,
+		Metadata: map[string]string{CurrentVersionKey: strconv.FormatInt(currentVersion, 10)},
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
@@ -0,0 +1,125 @@
+package filterexpr
+
+import (
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"strconv"
+	"time"
+)
+
+type FieldType int
+
+const (
+	IntType FieldType = iota
+	StringType
+	UserTypeType
+	TimestampType
+)
+
+func (t FieldType) String() string {
+	switch t {
+	case IntType:
+		return "integer"
+	case StringType:
+		return "string"
+	case UserTypeType:
+		return "UserType"
+	default:
+		return "timestamp"
+	}
+}
+
+// Field is a field of User or of its items which may be restricted by filter
+type Field struct {
+	Name string
+	Type FieldType
+	// Item is true for fields of items, restriction is satisfied when any item of user satisfies it
+	Item bool
+	// Nullable field is not set for users or items which were never updated, no restriction is satisfied by them
+	Nullable bool
+	// Bits is size of integer column, literals out of its range are rejected
+	Bits int
+}
+
+var fields = map[string]*Field{
+	"id":               {Name: "id", Type: IntType, Bits: 64},
+	"name":             {Name: "name", Type: StringType},
+	"age":              {Name: "age", Type: IntType, Bits: 32},
+	"user_type":        {Name: "user_type", Type: UserTypeType},
+	"created_at":       {Name: "created_at", Type: TimestampType},
+	"updated_at":       {Name: "updated_at", Type: TimestampType, Nullable: true},
+	"items.id":         {Name: "items.id", Type: IntType, Item: true, Bits: 64},
+	"items.name":       {Name: "items.name", Type: StringType, Item: true},
+	"items.created_at": {Name: "items.created_at", Type: TimestampType, Item: true},
+	"items.updated_at": {Name: "items.updated_at", Type: TimestampType, Item: true, Nullable: true},
+}
+
+// userValue returns value of non-item field of user, ok is false when nullable field is not set
+func userValue(field *Field, user *api.User) (interface{}, bool) {
+	switch field.Name {
+	case "id":
+		id, err := strconv.ParseInt(user.GetId(), 10, 64)
+		return id, err == nil
+	case "name":
+		return user.GetName(), true
+	case "age":
+		return int64(user.GetAge()), true
+	case "user_type":
+		return user.GetUserType(), true
+	case "created_at":
+		return user.GetCreatedAt().AsTime(), true
+	case "updated_at":
+		return user.GetUpdatedAt().AsTime(), user.GetUpdatedAt() != nil
+	}
+	return nil, false
+}
+
+// itemValue returns value of item field, ok is false when nullable field is not set
+func itemValue(field *Field, item *api.Item) (interface{}, bool) {
+	switch field.Name {
+	case "items.id":
+		id, err := strconv.ParseInt(item.GetId(), 10, 64)
+		return id, err == nil
+	case "items.name":
+		return item.GetName(), true
+	case "items.created_at":
+		return item.GetCreatedAt().AsTime(), item.GetCreatedAt() != nil
+	case "items.updated_at":
+		return item.GetUpdatedAt().AsTime(), item.GetUpdatedAt() != nil
+	}
+	return nil, false
+}
+
+// parseValue converts literal of restriction to type of field: int64, string, api.UserType or time.Time
+func parseValue(field *Field, value token) (interface{}, error) {
+	switch field.Type {
+	case IntType:
+		if value.kind != numberToken {
+			return nil, errorAt(value.pos, "%s is integer, %s is not", field.Name, value)
+		}
+		parsed, err := strconv.ParseInt(value.text, 10, field.Bits)
+		if err != nil {
+			return nil, errorAt(value.pos, "%s is out of range of %s", value, field.Name)
+		}
+		return parsed, nil
+	case StringType:
+		if value.kind != stringToken && value.kind != identToken {
+			return nil, errorAt(value.pos, "%s is string, %s is not", field.Name, value)
+		}
+		return value.text, nil
+	case UserTypeType:
+		userType, ok := api.UserType_value[value.text]
+		if value.kind != identToken || !ok {
+			return nil, errorAt(value.pos, "%s is not a UserType", value)
+		}
+		return api.UserType(userType), nil
+	default:
+		if value.kind != stringToken {
+			return nil, errorAt(value.pos, "%s is timestamp, quoted RFC 3339 time is expected instead of %s", field.Name, value)
+		}
+		parsed, err := time.Parse(time.RFC3339Nano, value.text)
+		if err != nil {
+			return nil, errorAt(value.pos, "%s is not RFC 3339 time", value)
+		}
+		return parsed.UTC(), nil
+	}
+}
@@ -0,0 +1,103 @@
+package filterexpr
+
+import (
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testUser = &api.User{
+	Id:        "42",
+	Name:      "John \"Johnny\" Smith",
+	Age:       30,
+	UserType:  api.UserType_CUSTOMER_USER_TYPE,
+	CreatedAt: timestamppb.New(time.Date(2021, 5, 1, 10, 0, 0, 0, time.UTC)),
+	Items: []*api.Item{
+		{Id: "7", Name: "laptop", CreatedAt: timestamppb.New(time.Date(2021, 5, 2, 10, 0, 0, 0, time.UTC))},
+		{Id: "8", Name: "phone", CreatedAt: timestamppb.New(time.Date(2021, 5, 3, 10, 0, 0, 0, time.UTC))},
+	},
+}
+
+func TestMatch(t *testing.T) {
+	testCases := []struct {
+		filter   string
+		expected bool
+	}{
+		{``, true},
+		{`user_type = CUSTOMER_USER_TYPE AND age >= 18 AND items.name:"laptop"`, true},
+		{`user_type != CUSTOMER_USER_TYPE`, false},
+		{`age > 30 OR name:"Johnny"`, true},
+		{`age < 18 OR age > 60`, false},
+		{`age >= 18 age <= 29`, false},
+		{`NOT (age < 18 OR age > 60) id = 42`, true},
+		{`items.name:"lap"`, false},
+		{`items.id > 7 AND items.created_at < "2021-05-03T00:00:00Z"`, true},
+		{`created_at >= "2021-05-01T10:00:00Z" AND created_at < "2021-05-01T10:00:01+00:00"`, true},
+		{`updated_at > "2000-01-01T00:00:00Z"`, false},
+		{`NOT updated_at > "2000-01-01T00:00:00Z"`, true},
+		{`name = "John \"Johnny\" Smith"`, true},
+		{`name:Smith`, true},
+	}
+
+	for i := range testCases {
+		tc := &testCases[i]
+		t.Run(tc.filter, func(t *testing.T) {
+			expr, err := Parse(tc.filter)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, Match(expr, testUser))
+		})
+	}
+}
+
+func TestParse_shouldBindOrTighterThanAnd(t *testing.T) {
+	expr, err := Parse(`age = 1 AND age = 2 OR age = 3`)
+
+	assert.NoError(t, err)
+	and, ok := expr.(And)
+	assert.True(t, ok)
+	assert.IsType(t, Or{}, and.Right)
+}
+
+func TestParse_shouldLimitLengthOfFilterInCharacters(t *testing.T) {
+	name := strings.Repeat("ж", MaxLength-len(`name:""`))
+
+	_, err := Parse(`name:"` + name + `"`)
+	assert.NoError(t, err)
+
+	_, err = Parse(`name:"` + name + `ж"`)
+	assert.EqualError(t, err, "filter is invalid at position 2049: filter must not be longer than 2048 characters")
+}
+
+func TestParse_shouldReturnPositionOfError(t *testing.T) {
+	testCases := []struct {
+		filter           string
+		expectedErrorMsg string
+	}{
+		{`age >= `, "filter is invalid at position 8: value is expected instead of end of filter"},
+		{`age >= 18 AND`, "filter is invalid at position 14: field is expected instead of end of filter"},
+		{`salary > 100`, "filter is invalid at position 1: field 'salary' is unknown"},
+		{`age = "18"`, "filter is invalid at position 7: age is integer, \"18\" is not"},
+		{`user_type > EMPLOYEE_USER_TYPE`, "filter is invalid at position 11: user_type supports only = and != operators"},
+		{`user_type = ADMIN`, "filter is invalid at position 13: 'ADMIN' is not a UserType"},
+		{`age:18`, "filter is invalid at position 4: ':' is supported by name and items fields only, age is integer"},
+		{`created_at > "yesterday"`, "filter is invalid at position 14: \"yesterday\" is not RFC 3339 time"},
+		{`(age = 1 OR age = 2`, "filter is invalid at position 20: ')' is expected instead of end of filter"},
+		{`age = 1)`, "filter is invalid at position 8: unexpected ')'"},
+		{`name = "John`, "filter is invalid at position 8: string is not closed"},
+		{`age = 1 ; drop table`, "filter is invalid at position 9: unexpected character ';'"},
+		{`age 18`, "filter is invalid at position 5: comparison operator is expected instead of '18'"},
+		{`age > 9999999999`, "filter is invalid at position 7: '9999999999' is out of range of age"},
+		{`items.id = 9223372036854775808`, "filter is invalid at position 12: '9223372036854775808' is out of range of items.id"},
+	}
+
+	for i := range testCases {
+		tc := &testCases[i]
+		t.Run(tc.filter, func(t *testing.T) {
+			_, err := Parse(tc.filter)
+			assert.EqualError(t, err, tc.expectedErrorMsg)
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package filterexpr
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	endToken tokenKind = iota
+	identToken
+	stringToken
+	numberToken
+	operatorToken
+	leftParenToken
+	rightParenToken
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// pos is 1-based position of the first character of token in filter
+	pos int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case endToken:
+		return "end of filter"
+	case stringToken:
+		return fmt.Sprintf("%q", t.text)
+	default:
+		return fmt.Sprintf("'%s'", t.text)
+	}
+}
+
+// SyntaxError is a filter error at position of filter counted from 1
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("filter is invalid at position %d: %s", e.Pos, e.Msg)
+}
+
+func errorAt(pos int, format string, args ...interface{}) *SyntaxError {
+	return &SyntaxError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+var operators = []string{"<=", ">=", "!=", "=", "<", ">", ":"}
+
+func tokenize(filter string) ([]token, error) {
+	runes := []rune(filter)
+	tokens := make([]token, 0)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: leftParenToken, text: "(", pos: pos})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: rightParenToken, text: ")", pos: pos})
+			i++
+		case r == '"':
+			text, next, err := readString(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: stringToken, text: text, pos: pos})
+			i = next
+		case r == '-' || unicode.IsDigit(r):
+			next := i + 1
+			for next < len(runes) && unicode.IsDigit(runes[next]) {
+				next++
+			}
+			if next == i+1 && r == '-' {
+				return nil, errorAt(pos, "'-' must be followed by digits")
+			}
+			tokens = append(tokens, token{kind: numberToken, text: string(runes[i:next]), pos: pos})
+			i = next
+		case isIdentRune(r):
+			next := i
+			for next < len(runes) && (isIdentRune(runes[next]) || unicode.IsDigit(runes[next]) || runes[next] == '.') {
+				next++
+			}
+			tokens = append(tokens, token{kind: identToken, text: string(runes[i:next]), pos: pos})
+			i = next
+		default:
+			operator := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(string(runes[i:]), candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if operator == "" {
+				return nil, errorAt(pos, "unexpected character '%c'", r)
+			}
+			tokens = append(tokens, token{kind: operatorToken, text: operator, pos: pos})
+			i += len(operator)
+		}
+	}
+	return append(tokens, token{kind: endToken, pos: len(runes) + 1}), nil
+}
+
+// readString reads double quoted string starting at runes[start], \" and \\ are escapes of quote and backslash
+func readString(runes []rune, start int) (string, int, error) {
+	var text strings.Builder
+	for i := start + 1; i < len(runes); i++ {
+		switch runes[i] {
+		case '"':
+			return text.String(), i + 1, nil
+		case '\\':
+			if i+1 == len(runes) || (runes[i+1] != '"' && runes[i+1] != '\\') {
+				return "", 0, errorAt(i+1, "only \\\" and \\\\ escapes are supported")
+			}
+			i++
+			text.WriteRune(runes[i])
+		default:
+			text.WriteRune(runes[i])
+		}
+	}
+	return "", 0, errorAt(start+1, "string is not closed")
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
@@ -0,0 +1,83 @@
+package filterexpr
+
+import (
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"strings"
+	"time"
+)
+
+// Match reports whether user satisfies expr, it is the predicate of storages which can not run SQL.
+// Every user matches nil expr
+func Match(expr Expr, user *api.User) bool {
+	switch e := expr.(type) {
+	case nil:
+		return true
+	case And:
+		return Match(e.Left, user) && Match(e.Right, user)
+	case Or:
+		return Match(e.Left, user) || Match(e.Right, user)
+	case Not:
+		return !Match(e.Operand, user)
+	case Restriction:
+		if !e.Field.Item {
+			value, ok := userValue(e.Field, user)
+			return ok && e.satisfiedBy(value)
+		}
+		for _, item := range user.GetItems() {
+			if value, ok := itemValue(e.Field, item); ok && e.satisfiedBy(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r Restriction) satisfiedBy(value interface{}) bool {
+	if r.Operator == Has {
+		if r.Field.Item {
+			return compare(value, r.Value) == 0
+		}
+		return strings.Contains(value.(string), r.Value.(string))
+	}
+	c := compare(value, r.Value)
+	switch r.Operator {
+	case Equal:
+		return c == 0
+	case NotEqual:
+		return c != 0
+	case Less:
+		return c < 0
+	case LessOrEqual:
+		return c <= 0
+	case Greater:
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+// compare compares values of the same field type
+func compare(a, b interface{}) int {
+	switch a := a.(type) {
+	case int64:
+		return compareInt64(a, b.(int64))
+	case api.UserType:
+		return compareInt64(int64(a), int64(b.(api.UserType)))
+	case string:
+		return strings.Compare(a, b.(string))
+	case time.Time:
+		return compareInt64(a.UnixNano(), b.(time.Time).UnixNano())
+	}
+	return 0
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
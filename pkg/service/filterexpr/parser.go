@@ -0,0 +1,205 @@
+package filterexpr
+
+import "unicode/utf8"
+
+// MaxLength limits length of filter, so filter can not exhaust resources of parser and database
+const MaxLength = 2048
+
+// maxDepth limits nesting of parentheses
+const maxDepth = 32
+
+type Operator string
+
+const (
+	Equal          Operator = "="
+	NotEqual       Operator = "!="
+	Less           Operator = "<"
+	LessOrEqual    Operator = "<="
+	Greater        Operator = ">"
+	GreaterOrEqual Operator = ">="
+	// Has is satisfied by name containing value or by any item having field equal to value
+	Has Operator = ":"
+)
+
+// Expr is a type checked filter expression
+type Expr interface {
+	expr()
+}
+
+type And struct {
+	Left  Expr
+	Right Expr
+}
+
+type Or struct {
+	Left  Expr
+	Right Expr
+}
+
+type Not struct {
+	Operand Expr
+}
+
+// Restriction compares field with Value having Go type of the field: int64, string, api.UserType or time.Time
+type Restriction struct {
+	Field    *Field
+	Operator Operator
+	Value    interface{}
+}
+
+func (And) expr()         {}
+func (Or) expr()          {}
+func (Not) expr()         {}
+func (Restriction) expr() {}
+
+// Parse parses AIP-160 style filter, e.g. `user_type = CUSTOMER_USER_TYPE AND age >= 18 AND items.name:"laptop"`.
+// AND binds weaker than OR and may be omitted between restrictions, nil is returned for empty filter
+func Parse(filter string) (Expr, error) {
+	if utf8.RuneCountInString(filter) > MaxLength {
+		return nil, errorAt(MaxLength+1, "filter must not be longer than %d characters", MaxLength)
+	}
+	tokens, err := tokenize(filter)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == endToken {
+		return nil, nil
+	}
+	expr, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next.kind != endToken {
+		return nil, errorAt(next.pos, "unexpected %s", next)
+	}
+	return expr, nil
+}
+
+type parser struct {
+	tokens []token
+	i      int
+	depth  int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != endToken {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == identToken && t.text == keyword
+}
+
+// expression is a sequence of factors joined by AND or by whitespace
+func (p *parser) expression() (Expr, error) {
+	left, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if p.isKeyword("AND") {
+			p.next()
+		} else if t := p.peek(); t.kind != leftParenToken && (t.kind != identToken || p.isKeyword("OR")) {
+			return left, nil
+		}
+		right, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		left = And{Left: left, Right: right}
+	}
+}
+
+// factor is a sequence of terms joined by OR
+func (p *parser) factor() (Expr, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("OR") {
+		p.next()
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = Or{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) term() (Expr, error) {
+	if p.isKeyword("NOT") {
+		p.next()
+		operand, err := p.simple()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Operand: operand}, nil
+	}
+	return p.simple()
+}
+
+func (p *parser) simple() (Expr, error) {
+	if p.peek().kind != leftParenToken {
+		return p.restriction()
+	}
+	open := p.next()
+	if p.depth++; p.depth > maxDepth {
+		return nil, errorAt(open.pos, "parentheses must not be nested deeper than %d", maxDepth)
+	}
+	expr, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if closing := p.next(); closing.kind != rightParenToken {
+		return nil, errorAt(closing.pos, "')' is expected instead of %s", closing)
+	}
+	p.depth--
+	return expr, nil
+}
+
+func (p *parser) restriction() (Expr, error) {
+	name := p.next()
+	if name.kind != identToken || name.text == "AND" || name.text == "OR" || name.text == "NOT" {
+		return nil, errorAt(name.pos, "field is expected instead of %s", name)
+	}
+	field, ok := fields[name.text]
+	if !ok {
+		return nil, errorAt(name.pos, "field %s is unknown", name)
+	}
+	operator := p.next()
+	if operator.kind != operatorToken {
+		return nil, errorAt(operator.pos, "comparison operator is expected instead of %s", operator)
+	}
+	if err := checkOperator(field, Operator(operator.text), operator.pos); err != nil {
+		return nil, err
+	}
+	value := p.next()
+	if value.kind != stringToken && value.kind != numberToken && value.kind != identToken {
+		return nil, errorAt(value.pos, "value is expected instead of %s", value)
+	}
+	parsed, err := parseValue(field, value)
+	if err != nil {
+		return nil, err
+	}
+	return Restriction{Field: field, Operator: Operator(operator.text), Value: parsed}, nil
+}
+
+func checkOperator(field *Field, operator Operator, pos int) error {
+	if field.Type == UserTypeType && operator != Equal && operator != NotEqual {
+		return errorAt(pos, "%s supports only = and != operators", field.Name)
+	}
+	if operator == Has && !field.Item && field.Type != StringType {
+		return errorAt(pos, "':' is supported by name and items fields only, %s is %s", field.Name, field.Type)
+	}
+	return nil
+}
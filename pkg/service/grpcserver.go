@@ -4,41 +4,90 @@ import (
 	"context"
 	api "github.com/fev0ks/UserServiceSC/pkg/api"
 	"github.com/fev0ks/UserServiceSC/pkg/service/errorhandler"
-	"github.com/fev0ks/UserServiceSC/pkg/service/postgres"
 	"github.com/fev0ks/UserServiceSC/pkg/service/validation"
 )
 
 type GRPCServer struct {
 	api.UnimplementedUserServiceServer
+	repository UserRepository
 }
 
-func (s *GRPCServer) CreateUser(context context.Context, request *api.CreateUserRequest) (*api.User, error) {
+func NewGRPCServer(repository UserRepository) *GRPCServer {
+	return &GRPCServer{repository: repository}
+}
+
+func (s *GRPCServer) CreateUser(ctx context.Context, request *api.CreateUserRequest) (*api.User, error) {
 	if err := validation.ValidateCreateUserRequestData(request); err != nil {
 		return nil, errorhandler.NewInvalidArgumentError(err.Error())
 	}
-	return postgres.CreateUser(request)
+	return s.repository.CreateUser(ctx, request)
+}
+func (s *GRPCServer) UpdateUser(ctx context.Context, request *api.UpdateUserRequest) (*api.User, error) {
+	id, err := validation.ValidateUserRequestData(request)
+	if err != nil {
+		return nil, errorhandler.NewInvalidArgumentError(err.Error())
+	}
+	return s.repository.UpdateUser(ctx, id, request)
+}
+func (s *GRPCServer) DeleteUser(ctx context.Context, request *api.DeleteUserRequest) (*api.DeleteUserResponse, error) {
+	id, err := validation.ParseId(request)
+	if err != nil {
+		return nil, errorhandler.NewInvalidArgumentError(err.Error())
+	}
+	return s.repository.DeleteUser(ctx, id, request)
+}
+func (s *GRPCServer) RestoreUser(ctx context.Context, request *api.RestoreUserRequest) (*api.User, error) {
+	id, err := validation.ParseId(request)
+	if err != nil {
+		return nil, errorhandler.NewInvalidArgumentError(err.Error())
+	}
+	return s.repository.RestoreUser(ctx, id, request)
+}
+func (s *GRPCServer) PurgeUser(ctx context.Context, request *api.PurgeUserRequest) (*api.PurgeUserResponse, error) {
+	id, err := validation.ParseId(request)
+	if err != nil {
+		return nil, errorhandler.NewInvalidArgumentError(err.Error())
+	}
+	return s.repository.PurgeUser(ctx, id, request)
+}
+func (s *GRPCServer) ListUser(ctx context.Context, request *api.ListUserRequest) (*api.ListUserResponse, error) {
+	if err := validation.ValidateListUserRequestData(request); err != nil {
+		return nil, errorhandler.NewInvalidArgumentError(err.Error())
+	}
+	return s.repository.ListUser(ctx, request)
+}
+func (s *GRPCServer) GetUser(ctx context.Context, request *api.GetUserRequest) (*api.User, error) {
+	id, err := validation.ParseId(request)
+	if err != nil {
+		return nil, errorhandler.NewInvalidArgumentError(err.Error())
+	}
+	return s.repository.GetUser(ctx, id)
 }
-func (s *GRPCServer) UpdateUser(context context.Context, request *api.UpdateUserRequest) (*api.User, error) {
-	if err := validation.ValidateUserRequestData(request); err != nil {
+func (s *GRPCServer) AddItems(ctx context.Context, request *api.AddItemsRequest) (*api.AddItemsResponse, error) {
+	userId, err := validation.ValidateAddItemsRequestData(request)
+	if err != nil {
 		return nil, errorhandler.NewInvalidArgumentError(err.Error())
 	}
-	return postgres.UpdateUser(request)
+	return s.repository.AddItems(ctx, userId, request)
 }
-func (s *GRPCServer) DeleteUser(context context.Context, request *api.DeleteUserRequest) (*api.DeleteUserResponse, error) {
-	if err := validation.ValidateId(request); err != nil {
+func (s *GRPCServer) RemoveItems(ctx context.Context, request *api.RemoveItemsRequest) (*api.RemoveItemsResponse, error) {
+	userId, itemIds, err := validation.ValidateRemoveItemsRequestData(request)
+	if err != nil {
 		return nil, errorhandler.NewInvalidArgumentError(err.Error())
 	}
-	return postgres.DeleteUser(request)
+	return s.repository.RemoveItems(ctx, userId, itemIds)
 }
-func (s *GRPCServer) ListUser(context context.Context, request *api.ListUserRequest) (*api.ListUserResponse, error) {
-	if err := validation.ValidatePageFilter(request); err != nil {
+func (s *GRPCServer) GetItem(ctx context.Context, request *api.GetItemRequest) (*api.Item, error) {
+	id, err := validation.ParseId(request)
+	if err != nil {
 		return nil, errorhandler.NewInvalidArgumentError(err.Error())
 	}
-	return postgres.ListUser(request)
+	return s.repository.GetItem(ctx, id)
 }
-func (s *GRPCServer) GetUser(context context.Context, request *api.GetUserRequest) (*api.User, error) {
-	if err := validation.ValidateId(request); err != nil {
+func (s *GRPCServer) ListItems(ctx context.Context, request *api.ListItemsRequest) (*api.ListItemsResponse, error) {
+	userId, err := validation.ValidateListItemsRequestData(request)
+	if err != nil {
 		return nil, errorhandler.NewInvalidArgumentError(err.Error())
 	}
-	return postgres.GetUser(request)
+	return s.repository.ListItems(ctx, userId, request)
 }
@@ -4,12 +4,18 @@ import (
 	"context"
 	"fmt"
 	api "github.com/fev0ks/UserServiceSC/pkg/api"
-	"github.com/fev0ks/UserServiceSC/pkg/service/postgres"
+	"github.com/fev0ks/UserServiceSC/pkg/service/errorhandler"
+	"github.com/fev0ks/UserServiceSC/pkg/service/memory"
+	"github.com/fev0ks/UserServiceSC/pkg/service/pagination"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 	"log"
 	"net"
 	"testing"
@@ -19,18 +25,11 @@ const bufSize = 1024 * 1024
 
 var lis *bufconn.Listener
 
-//init
-//TODO:
-// mock db,
-// sometimes some tests have additional spaces in message :(
 func init() {
 	lis = bufconn.Listen(bufSize)
 	log.Println("server is started")
 	server := grpc.NewServer()
-	api.RegisterUserServiceServer(server, &GRPCServer{})
-
-	dbConnection := postgres.OpenDataBaseConnection()
-	postgres.StorageInstance = postgres.NewStorage(dbConnection)
+	api.RegisterUserServiceServer(server, NewGRPCServer(memory.NewStorage(zap.NewNop())))
 	go func() {
 		if err := server.Serve(lis); err != nil {
 			log.Fatalf("Server exited with error: %v", err)
@@ -80,7 +79,7 @@ func TestCreateUser(t *testing.T) {
 			},
 			isPositive: false,
 			errCode:    codes.InvalidArgument,
-			errMsg:     "User validation failed: user - 'age:123  user_type:EMPLOYEE_USER_TYPE', err - name is missed",
+			errMsg:     "User validation failed: user - 'age:123 user_type:EMPLOYEE_USER_TYPE', err - name is missed",
 		},
 		{
 			caseName: "Invalid CreateUserRequest, age is negative",
@@ -91,7 +90,7 @@ func TestCreateUser(t *testing.T) {
 			},
 			isPositive: false,
 			errCode:    codes.InvalidArgument,
-			errMsg:     "User validation failed: user - 'age:-1  user_type:EMPLOYEE_USER_TYPE', err - age of user must be positive, age = -1",
+			errMsg:     "User validation failed: user - 'age:-1 user_type:EMPLOYEE_USER_TYPE', err - age of user must be positive, age = -1",
 		},
 		{
 			caseName: "Invalid CreateUserRequest, missedName in item",
@@ -115,7 +114,8 @@ func TestCreateUser(t *testing.T) {
 
 	client := api.NewUserServiceClient(conn)
 
-	for _, tc := range testCases {
+	for i := range testCases {
+		tc := &testCases[i]
 		t.Run(tc.caseName, func(t *testing.T) {
 			user, err := client.CreateUser(ctx, &tc.createUserRequest)
 			if tc.isPositive {
@@ -170,12 +170,13 @@ func TestGetUser(t *testing.T) {
 				Id: "12324789",
 			},
 			isPositive: false,
-			errMsg:     "GetUser: User not found by id = 12324789",
+			errMsg:     "User not found by id = 12324789",
 			errCode:    codes.NotFound,
 		},
 	}
 
-	for _, tc := range testCases {
+	for i := range testCases {
+		tc := &testCases[i]
 		t.Run(tc.caseName, func(t *testing.T) {
 			userAR, err := client.GetUser(ctx, &tc.getUserRequest)
 			if tc.isPositive {
@@ -250,11 +251,11 @@ func TestUpdateUser(t *testing.T) {
 					}},
 			},
 			isPositive: false,
-			errMsg:     fmt.Sprintf("User validation failed: user - 'name:\"testName\"  age:999  items:{id:\"%s\"  name:\"updatedItem\"}', err - id is missed", userER.Items[0].Id),
+			errMsg:     fmt.Sprintf("User validation failed: user - 'name:\"testName\" age:999 items:{id:\"%s\" name:\"updatedItem\"}', err - id is missed", userER.Items[0].Id),
 			errCode:    codes.InvalidArgument,
 		},
 		{
-			caseName: "Update User, missed item id",
+			caseName: "Update User, missed item id of renamed item",
 			updateUserRequest: api.UpdateUserRequest{
 				Id:       userER.Id,
 				Name:     userER.Name,
@@ -264,13 +265,15 @@ func TestUpdateUser(t *testing.T) {
 					{
 						Name: "updatedItem",
 					}},
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"items.name"}},
 			},
 			isPositive: false,
 			errMsg:     "Item validation failed: item - 'name:\"updatedItem\"', err - 'id is missed'",
 			errCode:    codes.InvalidArgument,
 		},
 	}
-	for _, tc := range testCases {
+	for i := range testCases {
+		tc := &testCases[i]
 		t.Run(tc.caseName, func(t *testing.T) {
 			userAR, err := client.UpdateUser(ctx, &tc.updateUserRequest)
 			if tc.isPositive {
@@ -300,6 +303,105 @@ func TestUpdateUser(t *testing.T) {
 	deleteUser(t, ctx, client, userER.Id)
 }
 
+func TestUpdateUser_updateMask(t *testing.T) {
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(bufDialer))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	client := api.NewUserServiceClient(conn)
+	userER := createUser(t, ctx, client, 2)
+
+	testCases := []struct {
+		caseName          string
+		updateUserRequest *api.UpdateUserRequest
+		name              string
+		age               int32
+		userType          api.UserType
+		itemNames         []string
+		errMsg            string
+	}{
+		{
+			caseName: "Update name only, age is not validated",
+			updateUserRequest: &api.UpdateUserRequest{
+				Id:         userER.Id,
+				Name:       "renamed",
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+			},
+			name:      "renamed",
+			age:       123,
+			userType:  api.UserType_EMPLOYEE_USER_TYPE,
+			itemNames: []string{"Im item #1", "Im item #2"},
+		},
+		{
+			caseName: "Update age and user_type",
+			updateUserRequest: &api.UpdateUserRequest{
+				Id:         userER.Id,
+				Age:        42,
+				UserType:   api.UserType_CUSTOMER_USER_TYPE,
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"age", "user_type"}},
+			},
+			name:      "renamed",
+			age:       42,
+			userType:  api.UserType_CUSTOMER_USER_TYPE,
+			itemNames: []string{"Im item #1", "Im item #2"},
+		},
+		{
+			caseName: "Update item names",
+			updateUserRequest: &api.UpdateUserRequest{
+				Id:         userER.Id,
+				Items:      []*api.UpdateItemRequest{{Id: userER.Items[1].Id, Name: "updatedItem"}},
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"items.name"}},
+			},
+			name:      "renamed",
+			age:       42,
+			userType:  api.UserType_CUSTOMER_USER_TYPE,
+			itemNames: []string{"Im item #1", "updatedItem"},
+		},
+		{
+			caseName: "Masked name is validated",
+			updateUserRequest: &api.UpdateUserRequest{
+				Id:         userER.Id,
+				Age:        42,
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name", "age"}},
+			},
+			errMsg: "User validation failed: user - 'id:\"" + userER.Id + "\" age:42 update_mask:{paths:\"name\" paths:\"age\"}', err - name is missed",
+		},
+		{
+			caseName: "Unknown path",
+			updateUserRequest: &api.UpdateUserRequest{
+				Id:         userER.Id,
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"created_at"}},
+			},
+			errMsg: "User validation failed: user - 'id:\"" + userER.Id + "\" update_mask:{paths:\"created_at\"}', err - update_mask path 'created_at' is not supported",
+		},
+	}
+	for i := range testCases {
+		tc := &testCases[i]
+		t.Run(tc.caseName, func(t *testing.T) {
+			userAR, err := client.UpdateUser(ctx, tc.updateUserRequest)
+			if tc.errMsg != "" {
+				fromError, _ := status.FromError(err)
+				assert.Equal(t, codes.InvalidArgument, fromError.Code())
+				assert.Equal(t, tc.errMsg, fromError.Message())
+				return
+			}
+			assert.Empty(t, err)
+			assert.Equal(t, tc.name, userAR.Name)
+			assert.Equal(t, tc.age, userAR.Age)
+			assert.Equal(t, tc.userType, userAR.UserType)
+			assert.NotEmpty(t, userAR.UpdatedAt)
+			itemNames := make([]string, 0, len(userAR.Items))
+			for _, item := range userAR.Items {
+				itemNames = append(itemNames, item.Name)
+			}
+			assert.Equal(t, tc.itemNames, itemNames)
+		})
+	}
+	deleteUser(t, ctx, client, userER.Id)
+}
+
 //TestListUser TODO update to check response users
 func TestListUser(t *testing.T) {
 	ctx := context.Background()
@@ -367,9 +469,40 @@ func TestListUser(t *testing.T) {
 			errMsg:     "page must be > 0, page = 0",
 			errCode:    codes.InvalidArgument,
 		},
+		{
+			caseName: "ListUser: page_size = 3",
+			listUserRequest: api.ListUserRequest{
+				PageSize: 3,
+			},
+			resultLen:  3,
+			isPositive: true,
+		},
+		{
+			caseName: "ListUser: invalid page_token",
+			listUserRequest: api.ListUserRequest{
+				PageToken: "abc",
+			},
+			isPositive: false,
+			errMsg:     "page_token is invalid",
+			errCode:    codes.InvalidArgument,
+		},
+		{
+			caseName: "ListUser: page_token with pageFilter",
+			listUserRequest: api.ListUserRequest{
+				PageFilter: &api.PageFilter{
+					Limit: 2,
+					Page:  1,
+				},
+				PageToken: "abc",
+			},
+			isPositive: false,
+			errMsg:     "page_token and pageFilter must not be used together",
+			errCode:    codes.InvalidArgument,
+		},
 	}
 
-	for _, tc := range testCases {
+	for i := range testCases {
+		tc := &testCases[i]
 		t.Run(tc.caseName, func(t *testing.T) {
 			users, err := client.ListUser(ctx, &tc.listUserRequest)
 			if tc.isPositive {
@@ -389,6 +522,235 @@ func TestListUser(t *testing.T) {
 	deleteUser(t, ctx, client, user4.Id)
 }
 
+func TestListUser_shouldReturnSamePageInIdOrder(t *testing.T) {
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(bufDialer))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	client := api.NewUserServiceClient(conn)
+	createdIds := make([]string, 0, 12)
+	for i := 0; i < 12; i++ {
+		createdIds = append(createdIds, createUser(t, ctx, client, 0).Id)
+	}
+	request := &api.ListUserRequest{PageFilter: &api.PageFilter{Limit: 5, Page: 2}}
+
+	first, err := client.ListUser(ctx, request)
+	assert.NoError(t, err)
+	second, err := client.ListUser(ctx, request)
+	assert.NoError(t, err)
+
+	assert.True(t, proto.Equal(first, second))
+	assert.Equal(t, 5, len(first.Users))
+	for i := 1; i < len(first.Users); i++ {
+		assert.True(t, pagination.IdLess(first.Users[i-1].Id, first.Users[i].Id))
+	}
+	assert.GreaterOrEqual(t, first.TotalSize, int32(12))
+	assert.Equal(t, uint32(2), first.Page)
+	assert.True(t, first.HasMore)
+
+	last, err := client.ListUser(ctx, &api.ListUserRequest{PageSize: uint32(first.TotalSize)})
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), last.Page)
+	assert.False(t, last.HasMore)
+	assert.Empty(t, last.NextPageToken)
+
+	for _, id := range createdIds {
+		deleteUser(t, ctx, client, id)
+	}
+}
+
+func TestListUser_shouldReturnEveryUserOnce_whenPagesAreWalkedByToken(t *testing.T) {
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(bufDialer))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	client := api.NewUserServiceClient(conn)
+	createdIds := make([]string, 0, 5)
+	for i := 0; i < 5; i++ {
+		createdIds = append(createdIds, createUser(t, ctx, client, 0).Id)
+	}
+
+	listedIds := make([]string, 0)
+	request := &api.ListUserRequest{PageSize: 2}
+	for {
+		response, err := client.ListUser(ctx, request)
+		if !assert.NoError(t, err) {
+			break
+		}
+		assert.LessOrEqual(t, len(response.Users), 2)
+		for _, user := range response.Users {
+			listedIds = append(listedIds, user.Id)
+		}
+		if response.NextPageToken == "" {
+			break
+		}
+		request.PageToken = response.NextPageToken
+		// users created during the walk are listed once as well
+		createdIds = append(createdIds, createUser(t, ctx, client, 0).Id)
+	}
+
+	listed := make(map[string]bool, len(listedIds))
+	for _, id := range listedIds {
+		assert.False(t, listed[id], "user %s is listed twice", id)
+		listed[id] = true
+	}
+	for _, id := range createdIds {
+		assert.True(t, listed[id], "user %s is skipped", id)
+		deleteUser(t, ctx, client, id)
+	}
+}
+
+func TestListUser_shouldFilterAndOrderUsers(t *testing.T) {
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(bufDialer))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	client := api.NewUserServiceClient(conn)
+	createdIds := make([]string, 0, 5)
+	for i, age := range []int32{30, 17, 45, 30, 60} {
+		user, err := client.CreateUser(ctx, &api.CreateUserRequest{
+			Name:     fmt.Sprintf("filter_%d", i),
+			Age:      age,
+			UserType: api.UserType_CUSTOMER_USER_TYPE,
+			Items:    createItemRequest(createItemsData(i)...),
+		})
+		assert.NoError(t, err)
+		createdIds = append(createdIds, user.Id)
+	}
+	minAge := int32(18)
+
+	testCases := []struct {
+		caseName      string
+		filter        *api.UserFilter
+		filterExpr    string
+		orderBy       string
+		expectedNames []string
+	}{
+		{
+			caseName:      "Adults by age descending",
+			filter:        &api.UserFilter{NamePrefix: "filter_", MinAge: &minAge},
+			orderBy:       "age desc",
+			expectedNames: []string{"filter_4", "filter_2", "filter_0", "filter_3"},
+		},
+		{
+			caseName:      "Having item by name",
+			filter:        &api.UserFilter{NamePrefix: "filter_", ItemName: "Im item #3"},
+			orderBy:       "name",
+			expectedNames: []string{"filter_3", "filter_4"},
+		},
+		{
+			caseName:      "Filter expression",
+			filter:        &api.UserFilter{NamePrefix: "filter_"},
+			filterExpr:    `age >= 18 AND (items.name:"Im item #2" OR age = 30)`,
+			orderBy:       "age",
+			expectedNames: []string{"filter_0", "filter_3", "filter_2", "filter_4"},
+		},
+		{
+			caseName:      "Underscore is not a wildcard",
+			filter:        &api.UserFilter{NameContains: "filter_1", UserType: api.UserType_CUSTOMER_USER_TYPE},
+			orderBy:       "created_at desc",
+			expectedNames: []string{"filter_1"},
+		},
+	}
+
+	for i := range testCases {
+		tc := &testCases[i]
+		t.Run(tc.caseName, func(t *testing.T) {
+			names := make([]string, 0)
+			request := &api.ListUserRequest{UserFilter: tc.filter, Filter: tc.filterExpr, OrderBy: tc.orderBy, PageSize: 1}
+			for {
+				response, err := client.ListUser(ctx, request)
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.Equal(t, int32(len(tc.expectedNames)), response.TotalSize)
+				for _, user := range response.Users {
+					names = append(names, user.Name)
+				}
+				if !response.HasMore {
+					break
+				}
+				request.PageToken = response.NextPageToken
+			}
+			assert.Equal(t, tc.expectedNames, names)
+		})
+	}
+
+	for _, id := range createdIds {
+		deleteUser(t, ctx, client, id)
+	}
+}
+
+func TestListUser_shouldRejectInvalidFilterAndOrder(t *testing.T) {
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(bufDialer))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	client := api.NewUserServiceClient(conn)
+	user1 := createUser(t, ctx, client, 0)
+	user2 := createUser(t, ctx, client, 0)
+	page, err := client.ListUser(ctx, &api.ListUserRequest{PageSize: 1, OrderBy: "name"})
+	assert.NoError(t, err)
+	minAge, maxAge := int32(30), int32(20)
+
+	testCases := []struct {
+		caseName        string
+		listUserRequest *api.ListUserRequest
+		errMsg          string
+	}{
+		{
+			caseName:        "Unknown order field",
+			listUserRequest: &api.ListUserRequest{OrderBy: "items desc"},
+			errMsg:          "order_by must be one of name, age, created_at or updated_at optionally followed by asc or desc, order_by = 'items desc'",
+		},
+		{
+			caseName:        "Unknown order direction",
+			listUserRequest: &api.ListUserRequest{OrderBy: "age down"},
+			errMsg:          "order_by direction must be asc or desc, order_by = 'age down'",
+		},
+		{
+			caseName:        "Age range",
+			listUserRequest: &api.ListUserRequest{UserFilter: &api.UserFilter{MinAge: &minAge, MaxAge: &maxAge}},
+			errMsg:          "user_filter.min_age must not be greater than max_age, min_age = 30, max_age = 20",
+		},
+		{
+			caseName:        "Unknown user type",
+			listUserRequest: &api.ListUserRequest{UserFilter: &api.UserFilter{UserType: 7}},
+			errMsg:          "user_filter.user_type is unknown, user_type = 7",
+		},
+		{
+			caseName:        "Filter syntax",
+			listUserRequest: &api.ListUserRequest{Filter: `age >= 18 AND`},
+			errMsg:          "filter is invalid at position 14: field is expected instead of end of filter",
+		},
+		{
+			caseName:        "Page token of another order",
+			listUserRequest: &api.ListUserRequest{PageSize: 1, OrderBy: "age", PageToken: page.NextPageToken},
+			errMsg:          "page_token is issued for another user_filter or order_by",
+		},
+	}
+
+	for i := range testCases {
+		tc := &testCases[i]
+		t.Run(tc.caseName, func(t *testing.T) {
+			_, err := client.ListUser(ctx, tc.listUserRequest)
+			fromError, _ := status.FromError(err)
+			assert.Equal(t, codes.InvalidArgument, fromError.Code())
+			assert.Equal(t, tc.errMsg, fromError.Message())
+		})
+	}
+	deleteUser(t, ctx, client, user1.Id)
+	deleteUser(t, ctx, client, user2.Id)
+}
+
 func TestDeleteUser(t *testing.T) {
 	ctx := context.Background()
 	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(bufDialer))
@@ -405,7 +767,326 @@ func TestDeleteUser(t *testing.T) {
 	fromError, _ := status.FromError(err)
 	assert.Nil(t, userAfterDelete)
 	assert.Equal(t, codes.NotFound, fromError.Code())
-	assert.Equal(t, fmt.Sprintf("GetUser: User not found by id = %s", user.GetId()), fromError.Message())
+	assert.Equal(t, fmt.Sprintf("User not found by id = %s", user.GetId()), fromError.Message())
+}
+
+func TestUpdateUser_replaceItems(t *testing.T) {
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(bufDialer))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	client := api.NewUserServiceClient(conn)
+	userER := createUser(t, ctx, client, 3)
+
+	userAR, err := client.UpdateUser(ctx, &api.UpdateUserRequest{
+		Id: userER.Id,
+		Items: []*api.UpdateItemRequest{
+			{Id: userER.Items[2].Id, Name: "updatedItem"},
+			{Name: "newItem"},
+			{Id: userER.Items[0].Id, Name: userER.Items[0].Name},
+		},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"items"}},
+	})
+	assert.Empty(t, err)
+	if assert.Equal(t, 3, len(userAR.Items)) {
+		assert.Equal(t, userER.Items[0].Id, userAR.Items[0].Id)
+		assert.Equal(t, "Im item #1", userAR.Items[0].Name)
+		assert.Equal(t, userER.Items[2].Id, userAR.Items[1].Id)
+		assert.Equal(t, "updatedItem", userAR.Items[1].Name)
+		assert.NotEmpty(t, userAR.Items[2].Id)
+		assert.Equal(t, "newItem", userAR.Items[2].Name)
+		assert.Equal(t, userER.Id, userAR.Items[2].UserId)
+	}
+	_, err = client.GetItem(ctx, &api.GetItemRequest{Id: userER.Items[1].Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	userAR, err = client.UpdateUser(ctx, &api.UpdateUserRequest{
+		Id:         userER.Id,
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"items"}},
+	})
+	assert.Empty(t, err)
+	assert.Empty(t, userAR.Items)
+
+	_, err = client.UpdateUser(ctx, &api.UpdateUserRequest{
+		Id:         userER.Id,
+		Items:      []*api.UpdateItemRequest{{Id: "1", Name: "first"}, {Id: "1", Name: "second"}},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"items"}},
+	})
+	fromError, _ := status.FromError(err)
+	assert.Equal(t, codes.InvalidArgument, fromError.Code())
+	assert.Equal(t, "Item validation failed: item - 'id:\"1\" name:\"second\"', err - 'id is duplicated'", fromError.Message())
+	deleteUser(t, ctx, client, userER.Id)
+}
+
+func TestUpdateUser_itemOwner(t *testing.T) {
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(bufDialer))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	client := api.NewUserServiceClient(conn)
+	userER := createUser(t, ctx, client, 1)
+	anotherUser := createUser(t, ctx, client, 1)
+
+	for _, path := range []string{"items", "items.name"} {
+		t.Run(path, func(t *testing.T) {
+			_, err := client.UpdateUser(ctx, &api.UpdateUserRequest{
+				Id:   userER.Id,
+				Name: "renamed",
+				Items: []*api.UpdateItemRequest{
+					{Id: userER.Items[0].Id, Name: "updatedItem"},
+					{Id: anotherUser.Items[0].Id, Name: "stolenItem"},
+					{Id: "999999", Name: "unknownItem"},
+				},
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name", path}},
+			})
+			fromError, _ := status.FromError(err)
+			assert.Equal(t, codes.NotFound, fromError.Code())
+			assert.Equal(t, fmt.Sprintf("Items not found for user %s: %s, 999999", userER.Id, anotherUser.Items[0].Id), fromError.Message())
+		})
+	}
+
+	userAR, err := getUser(ctx, client, userER.Id)
+	assert.Empty(t, err)
+	assert.Equal(t, userER.Name, userAR.Name)
+	assert.Equal(t, userER.Items[0].Name, userAR.Items[0].Name)
+	item, err := client.GetItem(ctx, &api.GetItemRequest{Id: anotherUser.Items[0].Id})
+	assert.Empty(t, err)
+	assert.Equal(t, anotherUser.Items[0].Name, item.Name)
+	deleteUser(t, ctx, client, userER.Id)
+	deleteUser(t, ctx, client, anotherUser.Id)
+}
+
+func TestUpdateUser_version(t *testing.T) {
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(bufDialer))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	client := api.NewUserServiceClient(conn)
+	userER := createUser(t, ctx, client, 1)
+	assert.Equal(t, int64(1), userER.Version)
+
+	renameRequest := &api.UpdateUserRequest{
+		Id:         userER.Id,
+		Name:       "renamed",
+		Version:    1,
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+	}
+	userAR, err := client.UpdateUser(ctx, renameRequest)
+	assert.Empty(t, err)
+	assert.Equal(t, int64(2), userAR.Version)
+
+	_, err = client.UpdateUser(ctx, renameRequest)
+	assertVersionMismatch(t, err, fmt.Sprintf("version of user %s is 2, but 1 is expected", userER.Id), "2")
+
+	_, err = client.DeleteUser(ctx, &api.DeleteUserRequest{Id: userER.Id, Version: 1})
+	assertVersionMismatch(t, err, fmt.Sprintf("version of user %s is 2, but 1 is expected", userER.Id), "2")
+
+	renameRequest.Version = 0
+	userAR, err = client.UpdateUser(ctx, renameRequest)
+	assert.Empty(t, err)
+	assert.Equal(t, int64(3), userAR.Version)
+
+	_, err = client.DeleteUser(ctx, &api.DeleteUserRequest{Id: userER.Id, Version: 3})
+	assert.Empty(t, err)
+	_, err = getUser(ctx, client, userER.Id)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestDeleteUser_softDelete(t *testing.T) {
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(bufDialer))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	client := api.NewUserServiceClient(conn)
+	userER := createUser(t, ctx, client, 1)
+	filter := fmt.Sprintf("id = %s", userER.Id)
+
+	_, err = client.RestoreUser(ctx, &api.RestoreUserRequest{Id: userER.Id})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = client.PurgeUser(ctx, &api.PurgeUserRequest{Id: userER.Id})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	deleteUser(t, ctx, client, userER.Id)
+
+	_, err = getUser(ctx, client, userER.Id)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.UpdateUser(ctx, &api.UpdateUserRequest{Id: userER.Id, Name: "renamed", Age: 1})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	listed, err := client.ListUser(ctx, &api.ListUserRequest{Filter: filter})
+	assert.Empty(t, err)
+	assert.Empty(t, listed.Users)
+	listed, err = client.ListUser(ctx, &api.ListUserRequest{Filter: filter, IncludeDeleted: true})
+	assert.Empty(t, err)
+	if assert.Equal(t, 1, len(listed.Users)) {
+		assert.NotEmpty(t, listed.Users[0].DeletedAt)
+		assert.Equal(t, 1, len(listed.Users[0].Items))
+	}
+
+	restored, err := client.RestoreUser(ctx, &api.RestoreUserRequest{Id: userER.Id, Version: 2})
+	assert.Empty(t, err)
+	assert.Empty(t, restored.DeletedAt)
+	assert.Equal(t, int64(3), restored.Version)
+	assert.Equal(t, userER.Items[0].Id, restored.Items[0].Id)
+
+	deleteUser(t, ctx, client, userER.Id)
+	_, err = client.PurgeUser(ctx, &api.PurgeUserRequest{Id: userER.Id, Version: 3})
+	assertVersionMismatch(t, err, fmt.Sprintf("version of user %s is 4, but 3 is expected", userER.Id), "4")
+	_, err = client.PurgeUser(ctx, &api.PurgeUserRequest{Id: userER.Id})
+	assert.Empty(t, err)
+	_, err = client.RestoreUser(ctx, &api.RestoreUserRequest{Id: userER.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	listed, err = client.ListUser(ctx, &api.ListUserRequest{Filter: filter, IncludeDeleted: true})
+	assert.Empty(t, err)
+	assert.Empty(t, listed.Users)
+}
+
+func TestUser_notFound(t *testing.T) {
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(bufDialer))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	client := api.NewUserServiceClient(conn)
+	userId := "987654321"
+
+	_, err = client.DeleteUser(ctx, &api.DeleteUserRequest{Id: userId})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, "User not found by id = 987654321", status.Convert(err).Message())
+	_, err = client.UpdateUser(ctx, &api.UpdateUserRequest{Id: userId, Name: "renamed", Age: 1})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, "User not found by id = 987654321", status.Convert(err).Message())
+	_, err = client.RestoreUser(ctx, &api.RestoreUserRequest{Id: userId})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.PurgeUser(ctx, &api.PurgeUserRequest{Id: userId})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.AddItems(ctx, &api.AddItemsRequest{UserId: userId, Items: createItemRequest(createItemsData(1)...)})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	user := createUser(t, ctx, client, 0)
+	deleteUser(t, ctx, client, user.Id)
+	_, err = client.DeleteUser(ctx, &api.DeleteUserRequest{Id: user.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestUser_malformedId(t *testing.T) {
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(bufDialer))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	client := api.NewUserServiceClient(conn)
+	userId := "abc"
+
+	_, err = client.GetUser(ctx, &api.GetUserRequest{Id: userId})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "id is malformed: 'abc' is not a valid id", status.Convert(err).Message())
+	_, err = client.DeleteUser(ctx, &api.DeleteUserRequest{Id: userId})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.UpdateUser(ctx, &api.UpdateUserRequest{Id: userId, Name: "renamed", Age: 1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.AddItems(ctx, &api.AddItemsRequest{UserId: userId, Items: createItemRequest(createItemsData(1)...)})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.GetItem(ctx, &api.GetItemRequest{Id: userId})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestItems(t *testing.T) {
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "", grpc.WithInsecure(), grpc.WithContextDialer(bufDialer))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	client := api.NewUserServiceClient(conn)
+	userER := createUser(t, ctx, client, 1)
+	anotherUser := createUser(t, ctx, client, 1)
+
+	added, err := client.AddItems(ctx, &api.AddItemsRequest{
+		UserId: userER.Id,
+		Items:  createItemRequest(createItemsData(3)...),
+	})
+	assert.Empty(t, err)
+	if !assert.Equal(t, 3, len(added.Items)) {
+		return
+	}
+	for _, item := range added.Items {
+		assert.NotEmpty(t, item.Id)
+		assert.Equal(t, userER.Id, item.UserId)
+		assert.NotEmpty(t, item.CreatedAt)
+	}
+
+	item, err := client.GetItem(ctx, &api.GetItemRequest{Id: added.Items[1].Id})
+	assert.Empty(t, err)
+	assert.Equal(t, "Im item #2", item.Name)
+
+	var listed []string
+	pageToken := ""
+	for {
+		page, err := client.ListItems(ctx, &api.ListItemsRequest{UserId: userER.Id, PageSize: 3, PageToken: pageToken})
+		if !assert.Empty(t, err) {
+			return
+		}
+		for _, item := range page.Items {
+			listed = append(listed, item.Id)
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		pageToken = page.NextPageToken
+	}
+	assert.Equal(t, []string{userER.Items[0].Id, added.Items[0].Id, added.Items[1].Id, added.Items[2].Id}, listed)
+
+	_, err = client.RemoveItems(ctx, &api.RemoveItemsRequest{
+		UserId:  userER.Id,
+		ItemIds: []string{added.Items[0].Id, anotherUser.Items[0].Id},
+	})
+	fromError, _ := status.FromError(err)
+	assert.Equal(t, codes.NotFound, fromError.Code())
+	assert.Equal(t, fmt.Sprintf("Items not found for user %s: %s", userER.Id, anotherUser.Items[0].Id), fromError.Message())
+
+	_, err = client.RemoveItems(ctx, &api.RemoveItemsRequest{UserId: userER.Id, ItemIds: []string{added.Items[0].Id, added.Items[2].Id}})
+	assert.Empty(t, err)
+	userAR, err := getUser(ctx, client, userER.Id)
+	assert.Empty(t, err)
+	assert.Equal(t, 2, len(userAR.Items))
+	assert.Equal(t, int64(3), userAR.Version)
+	_, err = client.GetItem(ctx, &api.GetItemRequest{Id: added.Items[0].Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, fmt.Sprintf("Item not found by id = %s", added.Items[0].Id), status.Convert(err).Message())
+
+	deleteUser(t, ctx, client, userER.Id)
+	_, err = client.GetItem(ctx, &api.GetItemRequest{Id: added.Items[1].Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.AddItems(ctx, &api.AddItemsRequest{UserId: userER.Id, Items: createItemRequest(createItemsData(1)...)})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	page, err := client.ListItems(ctx, &api.ListItemsRequest{UserId: userER.Id})
+	assert.Empty(t, err)
+	assert.Empty(t, page.Items)
+
+	_, err = client.ListItems(ctx, &api.ListItemsRequest{UserId: anotherUser.Id, PageToken: pageToken})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	deleteUser(t, ctx, client, anotherUser.Id)
+}
+
+func assertVersionMismatch(t *testing.T, err error, errMsg string, currentVersion string) {
+	fromError, _ := status.FromError(err)
+	assert.Equal(t, codes.Aborted, fromError.Code())
+	assert.Equal(t, errMsg, fromError.Message())
+	if assert.NotEmpty(t, fromError.Details()) {
+		errorInfo := fromError.Details()[0].(*errdetails.ErrorInfo)
+		assert.Equal(t, errorhandler.VersionMismatchReason, errorInfo.Reason)
+		assert.Equal(t, currentVersion, errorInfo.Metadata[errorhandler.CurrentVersionKey])
+	}
 }
 
 func deleteUser(t *testing.T, ctx context.Context, client api.UserServiceClient, userId string) {
@@ -0,0 +1,76 @@
+package healthcheck
+
+import (
+	"context"
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"time"
+)
+
+// Pinger reports whether storage is reachable
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Checker keeps statuses of grpc.health.v1 service up to date with storage reachability,
+// both overall server status ("") and status of UserService are tracked
+type Checker struct {
+	server   *health.Server
+	pinger   Pinger
+	interval time.Duration
+	timeout  time.Duration
+	services []string
+	logger   *zap.Logger
+}
+
+func NewChecker(server *health.Server, pinger Pinger, interval, timeout time.Duration, logger *zap.Logger) *Checker {
+	checker := &Checker{
+		server:   server,
+		pinger:   pinger,
+		interval: interval,
+		timeout:  timeout,
+		services: []string{"", api.UserService_ServiceDesc.ServiceName},
+		logger:   logger,
+	}
+	checker.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	return checker
+}
+
+// Run checks storage every interval until ctx is done
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		c.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check pings storage once and updates statuses, storage must answer within timeout to be SERVING
+func (c *Checker) Check(ctx context.Context) {
+	pingCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	if err := c.pinger.Ping(pingCtx); err != nil {
+		c.logger.Warn("storage is unreachable", zap.Error(err))
+		c.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+		return
+	}
+	c.setStatus(healthpb.HealthCheckResponse_SERVING)
+}
+
+// Shutdown switches all services to NOT_SERVING, later checks do not change statuses anymore
+func (c *Checker) Shutdown() {
+	c.server.Shutdown()
+}
+
+func (c *Checker) setStatus(status healthpb.HealthCheckResponse_ServingStatus) {
+	for _, service := range c.services {
+		c.server.SetServingStatus(service, status)
+	}
+}
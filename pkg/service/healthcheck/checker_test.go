@@ -0,0 +1,60 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"testing"
+	"time"
+)
+
+type pingerFunc func(ctx context.Context) error
+
+func (f pingerFunc) Ping(ctx context.Context) error {
+	return f(ctx)
+}
+
+func TestChecker_shouldTrackStorageReachability(t *testing.T) {
+	var pingErr error
+	server := health.NewServer()
+	checker := NewChecker(server, pingerFunc(func(ctx context.Context) error {
+		return pingErr
+	}), time.Second, time.Second, zap.NewNop())
+	assertStatus(t, server, healthpb.HealthCheckResponse_NOT_SERVING)
+
+	checker.Check(context.Background())
+	assertStatus(t, server, healthpb.HealthCheckResponse_SERVING)
+
+	pingErr = errors.New("connection refused")
+	checker.Check(context.Background())
+	assertStatus(t, server, healthpb.HealthCheckResponse_NOT_SERVING)
+
+	pingErr = nil
+	checker.Check(context.Background())
+	checker.Shutdown()
+	checker.Check(context.Background())
+	assertStatus(t, server, healthpb.HealthCheckResponse_NOT_SERVING)
+}
+
+func TestChecker_shouldNotServe_whenPingExceedsTimeout(t *testing.T) {
+	server := health.NewServer()
+	checker := NewChecker(server, pingerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), time.Second, 10*time.Millisecond, zap.NewNop())
+
+	checker.Check(context.Background())
+	assertStatus(t, server, healthpb.HealthCheckResponse_NOT_SERVING)
+}
+
+func assertStatus(t *testing.T, server *health.Server, expected healthpb.HealthCheckResponse_ServingStatus) {
+	for _, service := range []string{"", api.UserService_ServiceDesc.ServiceName} {
+		response, err := server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, response.Status)
+	}
+}
@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"github.com/fev0ks/UserServiceSC/pkg/config"
+	"github.com/fev0ks/UserServiceSC/pkg/service/errorhandler"
+	"github.com/fev0ks/UserServiceSC/pkg/service/requestid"
+	"github.com/fev0ks/UserServiceSC/pkg/service/rpcmethod"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// New builds logger writing JSON (or human-readable console) lines to stderr
+func New(cfg config.LogConfig) (*zap.Logger, error) {
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, fmt.Errorf("log level is invalid: %v", err)
+	}
+	zapConfig := zap.NewProductionConfig()
+	if cfg.Format == config.ConsoleLogFormat {
+		zapConfig = zap.NewDevelopmentConfig()
+	}
+	zapConfig.Level = zap.NewAtomicLevelAt(level)
+	zapConfig.EncoderConfig.TimeKey = "time"
+	zapConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	return zapConfig.Build()
+}
+
+type contextKey struct{}
+
+// NewContext returns ctx carrying logger, it is used by storage to log with request scoped fields
+func NewContext(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns logger of ctx or fallback if ctx does not carry it
+func FromContext(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*zap.Logger); ok {
+		return logger
+	}
+	return fallback
+}
+
+// UnaryServerInterceptor writes single line per RPC: failed RPC on warn level if client is a cause and
+// on error level otherwise, successful RPC on debug level. Logger with request id is put into the context,
+// so all lines of the RPC can be found by request id
+func UnaryServerInterceptor(logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		requestLogger := logger
+		if requestId := requestid.FromContext(ctx); requestId != "" {
+			requestLogger = logger.With(zap.String("request_id", requestId))
+		}
+		resp, err := handler(NewContext(ctx, requestLogger), req)
+		code := status.Code(err)
+		service, method := rpcmethod.Split(info.FullMethod)
+		fields := []zap.Field{
+			zap.String("grpc.service", service),
+			zap.String("grpc.method", method),
+			zap.String("grpc.code", code.String()),
+			zap.Duration("grpc.duration", time.Since(start)),
+		}
+		if userId := userIdOf(req, resp); userId != "" {
+			fields = append(fields, zap.String("user_id", userId))
+		}
+		if err != nil {
+			fields = append(fields, zap.String("error", status.Convert(err).Message()))
+			// client gets sanitized message of storage error, its cause is written to the log only
+			fields = append(fields, errorhandler.LogFields(err)...)
+		}
+		requestLogger.Check(levelOf(code), "finished unary call").Write(fields...)
+		return resp, err
+	}
+}
+
+func levelOf(code codes.Code) zapcore.Level {
+	switch code {
+	case codes.OK:
+		return zapcore.DebugLevel
+	case codes.Unknown, codes.DeadlineExceeded, codes.Unimplemented, codes.Internal, codes.Unavailable, codes.DataLoss:
+		return zapcore.ErrorLevel
+	default:
+		return zapcore.WarnLevel
+	}
+}
+
+type idData interface {
+	GetId() string
+}
+
+// userIdOf returns id of requested user, id of created user is taken from response
+func userIdOf(req interface{}, resp interface{}) string {
+	if data, ok := req.(idData); ok && data.GetId() != "" {
+		return data.GetId()
+	}
+	if data, ok := resp.(idData); ok {
+		return data.GetId()
+	}
+	return ""
+}
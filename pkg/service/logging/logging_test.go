@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"context"
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"github.com/fev0ks/UserServiceSC/pkg/service/errorhandler"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestUnaryServerInterceptor_shouldWriteSingleLinePerFailedCall(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	interceptor := UnaryServerInterceptor(zap.New(core))
+	info := &grpc.UnaryServerInfo{FullMethod: "/user_service_sc.UserService/GetUser"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errorhandler.NewNotFoundError("GetUser: User not found by id = 42")
+	}
+
+	_, err := interceptor(context.Background(), &api.GetUserRequest{Id: "42"}, info, handler)
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, logs.Len())
+	entry := logs.All()[0]
+	assert.Equal(t, zapcore.WarnLevel, entry.Level)
+	assert.Equal(t, map[string]interface{}{
+		"grpc.service":  "user_service_sc.UserService",
+		"grpc.method":   "GetUser",
+		"grpc.code":     "NotFound",
+		"grpc.duration": entry.ContextMap()["grpc.duration"],
+		"user_id":       "42",
+		"error":         "GetUser: User not found by id = 42",
+	}, entry.ContextMap())
+}
+
+func TestUnaryServerInterceptor_shouldWriteCauseOfStorageError(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	interceptor := UnaryServerInterceptor(zap.New(core))
+	info := &grpc.UnaryServerInfo{FullMethod: "/user_service_sc.UserService/AddItems"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errorhandler.FromError(&pq.Error{Code: "23503", Message: "insert violates foreign key", Table: "user_item", Constraint: "user_item_user_id_fkey"})
+	}
+
+	_, err := interceptor(context.Background(), &api.AddItemsRequest{UserId: "42"}, info, handler)
+
+	assert.Equal(t, "referenced resource does not exist", status.Convert(err).Message())
+	if assert.Equal(t, 1, logs.Len()) {
+		entry := logs.All()[0]
+		assert.Equal(t, zapcore.WarnLevel, entry.Level)
+		fields := entry.ContextMap()
+		assert.Equal(t, "FailedPrecondition", fields["grpc.code"])
+		assert.Equal(t, "referenced resource does not exist", fields["error"])
+		assert.Equal(t, "pq: insert violates foreign key", fields["cause"])
+		assert.Equal(t, "23503", fields["pq.code"])
+		assert.Equal(t, "user_item_user_id_fkey", fields["pq.constraint"])
+	}
+}
+
+func TestUnaryServerInterceptor_shouldNotWriteSuccessfulCall_whenLevelIsInfo(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	interceptor := UnaryServerInterceptor(zap.New(core))
+	info := &grpc.UnaryServerInfo{FullMethod: "/user_service_sc.UserService/CreateUser"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return &api.User{Id: "1"}, nil
+	}
+
+	_, err := interceptor(context.Background(), &api.CreateUserRequest{}, info, handler)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, logs.Len())
+}
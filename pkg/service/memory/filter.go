@@ -0,0 +1,69 @@
+package memory
+
+import (
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"github.com/fev0ks/UserServiceSC/pkg/service/filterexpr"
+	"strings"
+)
+
+// filterUsers returns users matching every set field of filter and expr, soft deleted users are skipped
+// unless includeDeleted is set
+func (s *Storage) filterUsers(filter *api.UserFilter, expr filterexpr.Expr, includeDeleted bool) []*api.User {
+	users := make([]*api.User, 0, len(s.users))
+	for _, user := range s.users {
+		if user.DeletedAt != nil && !includeDeleted {
+			continue
+		}
+		if matchUserFilter(user, filter) && filterexpr.Match(expr, user) {
+			users = append(users, user)
+		}
+	}
+	return users
+}
+
+func matchUserFilter(user *api.User, filter *api.UserFilter) bool {
+	if filter == nil {
+		return true
+	}
+	if filter.GetUserType() != api.UserType_INVALID_USER_TYPE && user.GetUserType() != filter.GetUserType() {
+		return false
+	}
+	if filter.MinAge != nil && user.GetAge() < filter.GetMinAge() {
+		return false
+	}
+	if filter.MaxAge != nil && user.GetAge() > filter.GetMaxAge() {
+		return false
+	}
+	if !strings.HasPrefix(user.GetName(), filter.GetNamePrefix()) || !strings.Contains(user.GetName(), filter.GetNameContains()) {
+		return false
+	}
+	createdAt := user.GetCreatedAt().AsTime()
+	if filter.CreatedAfter != nil && createdAt.Before(filter.GetCreatedAfter().AsTime()) {
+		return false
+	}
+	if filter.CreatedBefore != nil && !createdAt.Before(filter.GetCreatedBefore().AsTime()) {
+		return false
+	}
+	if filter.UpdatedAfter != nil || filter.UpdatedBefore != nil {
+		if user.UpdatedAt == nil {
+			return false
+		}
+		updatedAt := user.GetUpdatedAt().AsTime()
+		if filter.UpdatedAfter != nil && updatedAt.Before(filter.GetUpdatedAfter().AsTime()) {
+			return false
+		}
+		if filter.UpdatedBefore != nil && !updatedAt.Before(filter.GetUpdatedBefore().AsTime()) {
+			return false
+		}
+	}
+	return filter.GetItemName() == "" || hasItemNamed(user, filter.GetItemName())
+}
+
+func hasItemNamed(user *api.User, name string) bool {
+	for _, item := range user.GetItems() {
+		if item.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package memory
+
+import (
+	"context"
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"github.com/fev0ks/UserServiceSC/pkg/service/entityid"
+	"github.com/fev0ks/UserServiceSC/pkg/service/errorhandler"
+	"github.com/fev0ks/UserServiceSC/pkg/service/pagination"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"sort"
+	"strconv"
+)
+
+func (s *Storage) AddItems(ctx context.Context, userId entityid.ID, data *api.AddItemsRequest) (*api.AddItemsResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, err := s.getUserById(userId.String())
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*api.Item, 0, len(data.GetItems()))
+	for _, itemData := range data.GetItems() {
+		items = append(items, cloneItem(s.addItem(user, itemData.GetName())))
+	}
+	touchUser(user)
+	return &api.AddItemsResponse{Items: items}, nil
+}
+
+// RemoveItems deletes items only when every item belongs to the user
+func (s *Storage) RemoveItems(ctx context.Context, userId entityid.ID, itemIds []entityid.ID) (*api.RemoveItemsResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, err := s.getUserById(userId.String())
+	if err != nil {
+		return nil, err
+	}
+	if foreignIds := s.foreignItemIds(user, entityid.Strings(itemIds)); len(foreignIds) > 0 {
+		return nil, errorhandler.NewItemsNotFoundError(user.Id, foreignIds)
+	}
+	removed := make(map[string]bool, len(itemIds))
+	for _, itemId := range itemIds {
+		removed[itemId.String()] = true
+	}
+	items := make([]*api.Item, 0, len(user.Items))
+	for _, item := range user.Items {
+		if removed[item.Id] {
+			delete(s.itemOwners, item.Id)
+		} else {
+			items = append(items, item)
+		}
+	}
+	user.Items = items
+	touchUser(user)
+	return &api.RemoveItemsResponse{}, nil
+}
+
+func (s *Storage) GetItem(ctx context.Context, id entityid.ID) (*api.Item, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if item := s.getItemById(id.String()); item != nil {
+		return cloneItem(item), nil
+	}
+	return nil, errorhandler.NewItemNotFoundError(id.String())
+}
+
+func (s *Storage) ListItems(ctx context.Context, userId entityid.ID, data *api.ListItemsRequest) (*api.ListItemsResponse, error) {
+	token, err := pagination.ParseItemsRequest(data)
+	if err != nil {
+		return nil, errorhandler.NewInvalidArgumentError(err.Error())
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matched []*api.Item
+	for _, user := range s.users {
+		if user.DeletedAt != nil || (!userId.IsZero() && user.Id != userId.String()) {
+			continue
+		}
+		for _, item := range user.Items {
+			if token.AfterId == "" || pagination.IdLess(token.AfterId, item.Id) {
+				matched = append(matched, item)
+			}
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return pagination.IdLess(matched[i].Id, matched[j].Id)
+	})
+	limit := int(pagination.PageSize(data.GetPageSize()))
+	response := &api.ListItemsResponse{}
+	for i := 0; i < limit && i < len(matched); i++ {
+		response.Items = append(response.Items, cloneItem(matched[i]))
+	}
+	if len(matched) > limit {
+		response.NextPageToken = pagination.NextItemsToken(data, matched[limit-1]).Encode()
+	}
+	return response, nil
+}
+
+// foreignItemIds returns ids of items which do not belong to the user
+func (s *Storage) foreignItemIds(user *api.User, itemIds []string) []string {
+	var foreignIds []string
+	for _, itemId := range itemIds {
+		if s.itemOwners[itemId] != user.Id {
+			foreignIds = append(foreignIds, itemId)
+		}
+	}
+	return foreignIds
+}
+
+// addItem creates item of user with the next id
+func (s *Storage) addItem(user *api.User, name string) *api.Item {
+	s.lastItemId++
+	item := &api.Item{
+		Id:        strconv.FormatInt(s.lastItemId, 10),
+		Name:      name,
+		UserId:    user.Id,
+		CreatedAt: timestamppb.Now()}
+	user.Items = append(user.Items, item)
+	s.itemOwners[item.Id] = user.Id
+	return item
+}
+
+// touchUser marks user as updated when its items are changed
+func touchUser(user *api.User) {
+	user.UpdatedAt = timestamppb.Now()
+	user.Version++
+}
+
+func cloneItem(item *api.Item) *api.Item {
+	return proto.Clone(item).(*api.Item)
+}
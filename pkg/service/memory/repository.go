@@ -0,0 +1,280 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"github.com/fev0ks/UserServiceSC/pkg/service/entityid"
+	"github.com/fev0ks/UserServiceSC/pkg/service/errorhandler"
+	"github.com/fev0ks/UserServiceSC/pkg/service/filterexpr"
+	"github.com/fev0ks/UserServiceSC/pkg/service/pagination"
+	"github.com/fev0ks/UserServiceSC/pkg/service/updatemask"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"sort"
+	"strconv"
+)
+
+func (s *Storage) CreateUser(ctx context.Context, data *api.CreateUserRequest) (*api.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastUserId++
+	user := &api.User{
+		Id:        strconv.FormatInt(s.lastUserId, 10),
+		Name:      data.GetName(),
+		Age:       data.GetAge(),
+		UserType:  data.GetUserType(),
+		CreatedAt: timestamppb.Now(),
+		UpdatedAt: nil,
+		Version:   1}
+	for _, itemData := range data.GetItems() {
+		s.addItem(user, itemData.GetName())
+	}
+	s.users[user.Id] = user
+	return cloneUser(user), nil
+}
+
+func (s *Storage) UpdateUser(ctx context.Context, id entityid.ID, data *api.UpdateUserRequest) (*api.User, error) {
+	mask, err := updatemask.ParseUserMask(data.GetUpdateMask())
+	if err != nil {
+		return nil, errorhandler.NewInvalidArgumentError(err.Error())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, err := s.getUserById(id.String())
+	if err != nil {
+		s.log(ctx).Debug("UpdateUser: getUserById failed", zap.String("user_id", id.String()))
+		return nil, err
+	}
+	if err := checkUserVersion(user, data.GetVersion()); err != nil {
+		return nil, err
+	}
+	if mask.Items || mask.ItemNames {
+		if foreignIds := s.foreignItemIds(user, updatedItemIds(data.GetItems())); len(foreignIds) > 0 {
+			return nil, errorhandler.NewItemsNotFoundError(user.Id, foreignIds)
+		}
+	}
+	now := timestamppb.Now()
+	if mask.Name {
+		user.Name = data.GetName()
+	}
+	if mask.Age {
+		user.Age = data.GetAge()
+	}
+	if mask.UserType {
+		user.UserType = data.GetUserType()
+	}
+	user.UpdatedAt = now
+	user.Version++
+	if mask.Items {
+		s.replaceItems(user, data.GetItems(), now)
+	}
+	if mask.ItemNames {
+		s.updateItems(data.GetItems(), now)
+	}
+	return cloneUser(user), nil
+}
+
+func (s *Storage) DeleteUser(ctx context.Context, id entityid.ID, data *api.DeleteUserRequest) (*api.DeleteUserResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, err := s.getUserById(id.String())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkUserVersion(user, data.GetVersion()); err != nil {
+		return nil, err
+	}
+	user.DeletedAt = timestamppb.Now()
+	user.Version++
+	return &api.DeleteUserResponse{}, nil
+}
+
+func (s *Storage) RestoreUser(ctx context.Context, id entityid.ID, data *api.RestoreUserRequest) (*api.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, err := s.getDeletedUserById(id.String())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkUserVersion(user, data.GetVersion()); err != nil {
+		return nil, err
+	}
+	user.DeletedAt = nil
+	user.Version++
+	return cloneUser(user), nil
+}
+
+// PurgeUser permanently removes soft deleted user with its items
+func (s *Storage) PurgeUser(ctx context.Context, id entityid.ID, data *api.PurgeUserRequest) (*api.PurgeUserResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, err := s.getDeletedUserById(id.String())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkUserVersion(user, data.GetVersion()); err != nil {
+		return nil, err
+	}
+	for _, item := range user.Items {
+		delete(s.itemOwners, item.Id)
+	}
+	delete(s.users, id.String())
+	return &api.PurgeUserResponse{}, nil
+}
+
+func (s *Storage) ListUser(ctx context.Context, data *api.ListUserRequest) (*api.ListUserResponse, error) {
+	order, token, err := pagination.ParseRequest(data)
+	if err != nil {
+		return nil, errorhandler.NewInvalidArgumentError(err.Error())
+	}
+	expr, err := filterexpr.Parse(data.GetFilter())
+	if err != nil {
+		return nil, errorhandler.NewInvalidArgumentError(err.Error())
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matched := s.filterUsers(data.GetUserFilter(), expr, data.GetIncludeDeleted())
+	sort.Slice(matched, func(i, j int) bool {
+		return order.Less(matched[i], matched[j])
+	})
+	var start, limit uint64
+	if data.GetPageFilter() != nil {
+		limit = uint64(data.GetPageFilter().GetLimit())
+		start = limit * uint64(data.GetPageFilter().GetPage()-1)
+	} else {
+		limit = uint64(pagination.PageSize(data.GetPageSize()))
+		start = uint64(sort.Search(len(matched), func(i int) bool {
+			return order.After(matched[i], token)
+		}))
+	}
+	users := make([]*api.User, 0)
+	end := start
+	for ; end < start+limit && end < uint64(len(matched)); end++ {
+		users = append(users, cloneUser(matched[end]))
+	}
+	response := &api.ListUserResponse{
+		Users:     users,
+		TotalSize: int32(len(matched)),
+		HasMore:   end < uint64(len(matched)),
+	}
+	if data.GetPageFilter() != nil {
+		response.Page = data.GetPageFilter().GetPage()
+	} else {
+		response.Page = uint32(start/limit) + 1
+	}
+	if response.HasMore {
+		response.NextPageToken = pagination.NextToken(data, order, matched[end-1]).Encode()
+	}
+	return response, nil
+}
+
+func (s *Storage) GetUser(ctx context.Context, id entityid.ID) (*api.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, err := s.getUserById(id.String())
+	if err != nil {
+		return nil, err
+	}
+	return cloneUser(user), nil
+}
+
+// getUserById returns not deleted user
+func (s *Storage) getUserById(userId string) (*api.User, error) {
+	user, ok := s.users[userId]
+	if !ok || user.DeletedAt != nil {
+		return nil, errorhandler.NewUserNotFoundError(userId)
+	}
+	return user, nil
+}
+
+// replaceItems creates items without id, updates items with id and deletes items of user missing in data
+func (s *Storage) replaceItems(user *api.User, data []*api.UpdateItemRequest, now *timestamppb.Timestamp) {
+	kept := make(map[string]bool, len(data))
+	for _, itemData := range data {
+		kept[itemData.GetId()] = true
+	}
+	items := make([]*api.Item, 0, len(data))
+	for _, item := range user.Items {
+		if kept[item.Id] {
+			items = append(items, item)
+		} else {
+			delete(s.itemOwners, item.Id)
+		}
+	}
+	user.Items = items
+	s.updateItems(data, now)
+	for _, itemData := range data {
+		if itemData.GetId() == "" {
+			s.addItem(user, itemData.GetName())
+		}
+	}
+}
+
+// updatedItemIds returns ids of existing items of the request, items without id are new ones
+func updatedItemIds(data []*api.UpdateItemRequest) []string {
+	itemIds := make([]string, 0, len(data))
+	for _, item := range data {
+		if item.GetId() != "" {
+			itemIds = append(itemIds, item.GetId())
+		}
+	}
+	return itemIds
+}
+
+func (s *Storage) updateItems(data []*api.UpdateItemRequest, now *timestamppb.Timestamp) {
+	for _, itemData := range data {
+		if item := s.getItemById(itemData.GetId()); item != nil {
+			item.Name = itemData.GetName()
+			item.UpdatedAt = now
+		}
+	}
+}
+
+// getDeletedUserById returns soft deleted user
+func (s *Storage) getDeletedUserById(userId string) (*api.User, error) {
+	user, ok := s.users[userId]
+	if !ok {
+		return nil, errorhandler.NewUserNotFoundError(userId)
+	}
+	if user.DeletedAt == nil {
+		return nil, errorhandler.NewFailedPreconditionError(fmt.Sprintf("User %s is not deleted", userId))
+	}
+	return user, nil
+}
+
+// checkUserVersion compares version of user with expected one, 0 version is not compared
+func checkUserVersion(user *api.User, version int64) error {
+	if version != 0 && version != user.GetVersion() {
+		return errorhandler.NewVersionMismatchError(user.GetId(), version, user.GetVersion())
+	}
+	return nil
+}
+
+// getItemById returns item of not deleted user
+func (s *Storage) getItemById(itemId string) *api.Item {
+	user, ok := s.users[s.itemOwners[itemId]]
+	if !ok || user.DeletedAt != nil {
+		return nil
+	}
+	for _, item := range user.Items {
+		if item.Id == itemId {
+			return item
+		}
+	}
+	return nil
+}
+
+func cloneUser(user *api.User) *api.User {
+	return proto.Clone(user).(*api.User)
+}
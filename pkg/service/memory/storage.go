@@ -0,0 +1,37 @@
+package memory
+
+import (
+	"context"
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"github.com/fev0ks/UserServiceSC/pkg/service/logging"
+	"go.uber.org/zap"
+	"sync"
+)
+
+// Storage keeps users and their items in process memory, it is safe for concurrent use
+type Storage struct {
+	mu         sync.RWMutex
+	lastUserId int64
+	lastItemId int64
+	users      map[string]*api.User
+	itemOwners map[string]string
+	logger     *zap.Logger
+}
+
+func NewStorage(logger *zap.Logger) *Storage {
+	return &Storage{
+		users:      make(map[string]*api.User),
+		itemOwners: make(map[string]string),
+		logger:     logger,
+	}
+}
+
+// Ping always succeeds, memory storage is reachable while process is alive
+func (s *Storage) Ping(ctx context.Context) error {
+	return nil
+}
+
+// log returns logger with request scoped fields of ctx
+func (s *Storage) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, s.logger)
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"database/sql"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// dbStatsCollector reads sql.DB.Stats() on every scrape
+type dbStatsCollector struct {
+	db *sql.DB
+
+	maxOpenConnections *prometheus.Desc
+	openConnections    *prometheus.Desc
+	inUseConnections   *prometheus.Desc
+	idleConnections    *prometheus.Desc
+	waitCount          *prometheus.Desc
+	waitDuration       *prometheus.Desc
+}
+
+func newDBStatsCollector(db *sql.DB) *dbStatsCollector {
+	fqName := func(name string) string {
+		return prometheus.BuildFQName(namespace, "db", name)
+	}
+	return &dbStatsCollector{
+		db: db,
+		maxOpenConnections: prometheus.NewDesc(fqName("max_open_connections"),
+			"Maximum number of open connections to the database.", nil, nil),
+		openConnections: prometheus.NewDesc(fqName("open_connections"),
+			"The number of established connections both in use and idle.", nil, nil),
+		inUseConnections: prometheus.NewDesc(fqName("in_use_connections"),
+			"The number of connections currently in use.", nil, nil),
+		idleConnections: prometheus.NewDesc(fqName("idle_connections"),
+			"The number of idle connections.", nil, nil),
+		waitCount: prometheus.NewDesc(fqName("wait_count_total"),
+			"The total number of connections waited for.", nil, nil),
+		waitDuration: prometheus.NewDesc(fqName("wait_duration_seconds_total"),
+			"The total time blocked waiting for a new connection.", nil, nil),
+	}
+}
+
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpenConnections
+	ch <- c.openConnections
+	ch <- c.inUseConnections
+	ch <- c.idleConnections
+	ch <- c.waitCount
+	ch <- c.waitDuration
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.db.Stats()
+	ch <- prometheus.MustNewConstMetric(c.maxOpenConnections, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.openConnections, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.inUseConnections, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(c.idleConnections, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds())
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"github.com/fev0ks/UserServiceSC/pkg/service/rpcmethod"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"time"
+)
+
+const namespace = "user_service"
+
+// Metrics holds collectors of the server, they are registered in own registry instead of the global one
+// so several servers may live in one process
+type Metrics struct {
+	registry        *prometheus.Registry
+	handledTotal    *prometheus.CounterVec
+	handlingSeconds *prometheus.HistogramVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		handledTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "grpc_server_handled_total",
+			Help:      "Total number of RPCs completed on the server, regardless of success or failure.",
+		}, []string{"grpc_service", "grpc_method", "grpc_code"}),
+		handlingSeconds: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "grpc_server_handling_seconds",
+			Help:      "Histogram of response latency (seconds) of RPCs handled by the server.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"grpc_service", "grpc_method", "grpc_code"}),
+	}
+	m.registry.MustRegister(m.handledTotal, m.handlingSeconds)
+	return m
+}
+
+// RegisterDB exposes connection pool statistics of db
+func (m *Metrics) RegisterDB(db *sql.DB) {
+	m.registry.MustRegister(newDBStatsCollector(db))
+}
+
+// Handler serves metrics in Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// UnaryServerInterceptor counts RPCs and observes their latency by method and status code
+func (m *Metrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		service, method := rpcmethod.Split(info.FullMethod)
+		code := status.Code(err).String()
+		m.handledTotal.WithLabelValues(service, method, code).Inc()
+		m.handlingSeconds.WithLabelValues(service, method, code).Observe(time.Since(start).Seconds())
+		return resp, err
+	}
+}
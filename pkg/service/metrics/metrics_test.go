@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"github.com/fev0ks/UserServiceSC/pkg/service/errorhandler"
+	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"testing"
+)
+
+func TestUnaryServerInterceptor_shouldCountRequestsByMethodAndCode(t *testing.T) {
+	m := New()
+	interceptor := m.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/user_service_sc.UserService/GetUser"}
+	okHandler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return req, nil
+	}
+	failedHandler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errorhandler.NewInternalError("test error")
+	}
+
+	_, _ = interceptor(context.Background(), nil, info, okHandler)
+	_, _ = interceptor(context.Background(), nil, info, failedHandler)
+	_, _ = interceptor(context.Background(), nil, info, failedHandler)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.handledTotal.WithLabelValues("user_service_sc.UserService", "GetUser", "OK")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.handledTotal.WithLabelValues("user_service_sc.UserService", "GetUser", "Internal")))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.handlingSeconds))
+}
+
+func TestRegisterDB_shouldExposeConnectionPoolStats(t *testing.T) {
+	db, err := sql.Open("postgres", "host=localhost")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	assert.Equal(t, 6, testutil.CollectAndCount(newDBStatsCollector(db)))
+}
@@ -0,0 +1,41 @@
+package pagination
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+)
+
+var ErrItemsPageTokenIsNotMatch = errors.New("page_token is issued for another user_id")
+
+// ItemsRequest is ListItems request listed by keyset pages, items are ordered by id
+type ItemsRequest interface {
+	GetPageToken() string
+	GetUserId() string
+}
+
+// ParseItemsRequest returns token of ListItems page, token has to be issued for the same user_id
+func ParseItemsRequest(request ItemsRequest) (Token, error) {
+	token, err := DecodeToken(request.GetPageToken())
+	if err != nil || token.AfterId == "" {
+		return token, err
+	}
+	if token.Query != itemsQueryOf(request) {
+		return Token{}, ErrItemsPageTokenIsNotMatch
+	}
+	return token, nil
+}
+
+// NextItemsToken returns token of the page following lastItem of the page listed for request
+func NextItemsToken(request ItemsRequest, lastItem *api.Item) Token {
+	return Token{AfterId: lastItem.GetId(), Query: itemsQueryOf(request)}
+}
+
+func itemsQueryOf(request ItemsRequest) string {
+	hash := sha256.New()
+	hash.Write([]byte("items"))
+	hash.Write([]byte{0})
+	hash.Write([]byte(request.GetUserId()))
+	return base64.RawURLEncoding.EncodeToString(hash.Sum(nil)[:8])
+}
@@ -0,0 +1,29 @@
+package pagination
+
+import (
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseItemsRequest(t *testing.T) {
+	token := NextItemsToken(&api.ListItemsRequest{UserId: "7"}, &api.Item{Id: "42"}).Encode()
+
+	parsed, err := ParseItemsRequest(&api.ListItemsRequest{UserId: "7", PageToken: token})
+	assert.NoError(t, err)
+	assert.Equal(t, "42", parsed.AfterId)
+
+	parsed, err = ParseItemsRequest(&api.ListItemsRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "", parsed.AfterId)
+
+	_, err = ParseItemsRequest(&api.ListItemsRequest{UserId: "8", PageToken: token})
+	assert.Equal(t, ErrItemsPageTokenIsNotMatch, err)
+
+	userToken := NextToken(&api.ListUserRequest{}, Order{Field: IdField}, &api.User{Id: "42"}).Encode()
+	_, err = ParseItemsRequest(&api.ListItemsRequest{PageToken: userToken})
+	assert.Equal(t, ErrItemsPageTokenIsNotMatch, err)
+
+	_, err = ParseItemsRequest(&api.ListItemsRequest{PageToken: "%%%"})
+	assert.Equal(t, ErrInvalidPageToken, err)
+}
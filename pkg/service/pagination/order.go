@@ -0,0 +1,157 @@
+package pagination
+
+import (
+	"errors"
+	"fmt"
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fields of User which users may be ordered by
+const (
+	IdField        = "id"
+	NameField      = "name"
+	AgeField       = "age"
+	CreatedAtField = "created_at"
+	// UpdatedAtField orders users by updated_at, users which were never updated are ordered by created_at
+	UpdatedAtField = "updated_at"
+)
+
+var orderFields = map[string]bool{
+	NameField:      true,
+	AgeField:       true,
+	CreatedAtField: true,
+	UpdatedAtField: true,
+}
+
+// Order is parsed order_by of ListUser, users with equal values are ordered by id ascending
+type Order struct {
+	Field      string
+	Descending bool
+}
+
+// ParseOrderBy parses "field" or "field asc|desc", empty orderBy orders users by id
+func ParseOrderBy(orderBy string) (Order, error) {
+	parts := strings.Fields(orderBy)
+	if len(parts) == 0 {
+		return Order{Field: IdField}, nil
+	}
+	if len(parts) > 2 || !orderFields[parts[0]] {
+		return Order{}, fmt.Errorf("order_by must be one of name, age, created_at or updated_at "+
+			"optionally followed by asc or desc, order_by = '%s'", orderBy)
+	}
+	order := Order{Field: parts[0]}
+	if len(parts) == 2 {
+		switch strings.ToLower(parts[1]) {
+		case "asc":
+		case "desc":
+			order.Descending = true
+		default:
+			return Order{}, fmt.Errorf("order_by direction must be asc or desc, order_by = '%s'", orderBy)
+		}
+	}
+	return order, nil
+}
+
+// String returns normalized order_by
+func (o Order) String() string {
+	if o.Descending {
+		return o.Field + " desc"
+	}
+	return o.Field
+}
+
+// ValueOf returns value of ordering field of user as it is kept in page token
+func (o Order) ValueOf(user *api.User) string {
+	switch o.Field {
+	case NameField:
+		return user.GetName()
+	case AgeField:
+		return strconv.Itoa(int(user.GetAge()))
+	case CreatedAtField:
+		return user.GetCreatedAt().AsTime().Format(time.RFC3339Nano)
+	case UpdatedAtField:
+		return updatedAt(user).Format(time.RFC3339Nano)
+	default:
+		return ""
+	}
+}
+
+// ParseValue converts value of page token to type of ordering field: string, int32 or time.Time
+func (o Order) ParseValue(value string) (interface{}, error) {
+	switch o.Field {
+	case NameField:
+		return value, nil
+	case AgeField:
+		age, err := strconv.ParseInt(value, 10, 32)
+		return int32(age), err
+	case CreatedAtField, UpdatedAtField:
+		return time.Parse(time.RFC3339Nano, value)
+	default:
+		return nil, errors.New("users ordered by id have no ordering value")
+	}
+}
+
+// Less reports whether user a precedes user b
+func (o Order) Less(a, b *api.User) bool {
+	if c := o.compare(a, o.ValueOf(b)); c != 0 {
+		return c < 0
+	}
+	return IdLess(a.GetId(), b.GetId())
+}
+
+// After reports whether user follows the position of page token in the order
+func (o Order) After(user *api.User, token Token) bool {
+	if token.AfterId == "" {
+		return true
+	}
+	if c := o.compare(user, token.AfterValue); c != 0 {
+		return c > 0
+	}
+	return IdLess(token.AfterId, user.GetId())
+}
+
+// compare compares ordering field of user with value of page token respecting direction of the order
+func (o Order) compare(user *api.User, value string) int {
+	var c int
+	switch o.Field {
+	case NameField:
+		c = strings.Compare(user.GetName(), value)
+	case AgeField:
+		age, _ := strconv.ParseInt(value, 10, 32)
+		c = compareInt64(int64(user.GetAge()), age)
+	case CreatedAtField:
+		c = compareTime(user.GetCreatedAt().AsTime(), value)
+	case UpdatedAtField:
+		c = compareTime(updatedAt(user), value)
+	}
+	if o.Descending {
+		return -c
+	}
+	return c
+}
+
+func updatedAt(user *api.User) time.Time {
+	if user.GetUpdatedAt() != nil {
+		return user.GetUpdatedAt().AsTime()
+	}
+	return user.GetCreatedAt().AsTime()
+}
+
+func compareTime(t time.Time, value string) int {
+	parsed, _ := time.Parse(time.RFC3339Nano, value)
+	return compareInt64(t.UnixNano(), parsed.UnixNano())
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,40 @@
+package pagination
+
+import (
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseOrderBy(t *testing.T) {
+	testCases := []struct {
+		orderBy       string
+		expectedOrder Order
+	}{
+		{"", Order{Field: IdField}},
+		{"name", Order{Field: NameField}},
+		{" age  DESC ", Order{Field: AgeField, Descending: true}},
+		{"updated_at asc", Order{Field: UpdatedAtField}},
+	}
+
+	for i := range testCases {
+		tc := &testCases[i]
+		t.Run(tc.orderBy, func(t *testing.T) {
+			order, err := ParseOrderBy(tc.orderBy)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedOrder, order)
+		})
+	}
+}
+
+func TestOrder_After_shouldOrderEqualValuesById(t *testing.T) {
+	order := Order{Field: AgeField, Descending: true}
+	lastUser := &api.User{Id: "10", Age: 30}
+	token := NextToken(&api.ListUserRequest{}, order, lastUser)
+
+	assert.True(t, order.After(&api.User{Id: "11", Age: 30}, token))
+	assert.True(t, order.After(&api.User{Id: "2", Age: 29}, token))
+	assert.False(t, order.After(&api.User{Id: "9", Age: 30}, token))
+	assert.False(t, order.After(&api.User{Id: "12", Age: 31}, token))
+	assert.True(t, order.Less(&api.User{Id: "12", Age: 31}, lastUser))
+}
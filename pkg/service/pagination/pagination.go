@@ -0,0 +1,148 @@
+package pagination
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"github.com/fev0ks/UserServiceSC/pkg/service/entityid"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 1000
+)
+
+var (
+	ErrInvalidPageToken    = errors.New("page_token is invalid")
+	ErrPageTokenIsNotMatch = errors.New("page_token is issued for another user_filter or order_by")
+)
+
+// Token is a keyset cursor, next page starts after the user with AfterId and AfterValue of ordering field
+type Token struct {
+	AfterId string `json:"after_id"`
+	// AfterValue is empty when users are ordered by id
+	AfterValue string `json:"after_value,omitempty"`
+	// Query identifies user_filter, filter and order_by of the request the token is issued for
+	Query string `json:"query,omitempty"`
+}
+
+// NextToken returns token of the page following lastUser of the page listed for request in order
+func NextToken(request Request, order Order, lastUser *api.User) Token {
+	return Token{
+		AfterId:    lastUser.GetId(),
+		AfterValue: order.ValueOf(lastUser),
+		Query:      queryOf(request, order),
+	}
+}
+
+// Encode returns opaque page token, clients must not rely on its content
+func (t Token) Encode() string {
+	data, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeToken parses page token returned by Encode, empty pageToken is a cursor of the first page
+func DecodeToken(pageToken string) (Token, error) {
+	var token Token
+	if pageToken == "" {
+		return token, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(pageToken)
+	if err != nil {
+		return token, ErrInvalidPageToken
+	}
+	if err := json.Unmarshal(data, &token); err != nil {
+		return token, ErrInvalidPageToken
+	}
+	if _, err := entityid.Parse(token.AfterId); err != nil {
+		return token, ErrInvalidPageToken
+	}
+	return token, nil
+}
+
+// Request is ListUser request listed by keyset pages or by offset based pageFilter
+type Request interface {
+	GetPageToken() string
+	GetPageFilter() *api.PageFilter
+	GetUserFilter() *api.UserFilter
+	GetFilter() string
+	GetOrderBy() string
+	GetIncludeDeleted() bool
+}
+
+// ParseRequest returns order of ListUser request and token of its page, token has to be issued for the same
+// user_filter and order_by
+func ParseRequest(request Request) (Order, Token, error) {
+	if err := CheckPageFilter(request.GetPageFilter()); err != nil {
+		return Order{}, Token{}, err
+	}
+	order, err := ParseOrderBy(request.GetOrderBy())
+	if err != nil {
+		return Order{}, Token{}, err
+	}
+	token, err := DecodeToken(request.GetPageToken())
+	if err != nil || token.AfterId == "" {
+		return order, token, err
+	}
+	if token.Query != queryOf(request, order) {
+		return Order{}, Token{}, ErrPageTokenIsNotMatch
+	}
+	if order.Field != IdField {
+		if _, err := order.ParseValue(token.AfterValue); err != nil {
+			return Order{}, Token{}, ErrInvalidPageToken
+		}
+	}
+	return order, token, nil
+}
+
+// queryOf hashes filters of request and order, so token does not disclose them
+func queryOf(request Request, order Order) string {
+	data, _ := proto.MarshalOptions{Deterministic: true}.Marshal(request.GetUserFilter())
+	hash := sha256.New()
+	hash.Write(data)
+	hash.Write([]byte{0})
+	hash.Write([]byte(request.GetFilter()))
+	hash.Write([]byte{0})
+	hash.Write([]byte(order.String()))
+	if request.GetIncludeDeleted() {
+		hash.Write([]byte{0, 1})
+	}
+	return base64.RawURLEncoding.EncodeToString(hash.Sum(nil)[:8])
+}
+
+// CheckPageFilter rejects zero page and limit of pageFilter, offset of the page is computed from both of them
+func CheckPageFilter(filter *api.PageFilter) error {
+	if filter == nil {
+		return nil
+	}
+	if filter.GetPage() == 0 {
+		return fmt.Errorf("page must be > 0, page = %d", filter.GetPage())
+	}
+	if filter.GetLimit() == 0 {
+		return fmt.Errorf("limit must be > 0, limit = %d", filter.GetLimit())
+	}
+	return nil
+}
+
+// PageSize returns DefaultPageSize for unset size and coerces too big size to MaxPageSize
+func PageSize(size uint32) uint32 {
+	if size == 0 {
+		return DefaultPageSize
+	}
+	if size > MaxPageSize {
+		return MaxPageSize
+	}
+	return size
+}
+
+// IdLess compares numeric ids of users and items, shorter id is less since ids have no leading zeros
+func IdLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
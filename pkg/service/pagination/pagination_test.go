@@ -0,0 +1,70 @@
+package pagination
+
+import (
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDecodeToken_shouldReturnEncodedToken(t *testing.T) {
+	token, err := DecodeToken(Token{AfterId: "42"}.Encode())
+
+	assert.NoError(t, err)
+	assert.Equal(t, Token{AfterId: "42"}, token)
+}
+
+func TestDecodeToken_shouldRejectInvalidToken(t *testing.T) {
+	testCases := []struct {
+		caseName  string
+		pageToken string
+	}{
+		{"Not base64", "%%%"},
+		{"Not JSON", "bm90IGpzb24"},
+		{"Not numeric id", Token{AfterId: "1 or 1=1"}.Encode()},
+		{"Empty id", Token{}.Encode()},
+	}
+
+	for i := range testCases {
+		tc := &testCases[i]
+		t.Run(tc.caseName, func(t *testing.T) {
+			_, err := DecodeToken(tc.pageToken)
+			assert.Equal(t, ErrInvalidPageToken, err)
+		})
+	}
+}
+
+func TestParseRequest_shouldRejectTokenOfAnotherIncludeDeleted(t *testing.T) {
+	order := Order{Field: IdField}
+	token := NextToken(&api.ListUserRequest{}, order, &api.User{Id: "42"}).Encode()
+
+	_, parsed, err := ParseRequest(&api.ListUserRequest{PageToken: token})
+	assert.NoError(t, err)
+	assert.Equal(t, "42", parsed.AfterId)
+
+	_, _, err = ParseRequest(&api.ListUserRequest{PageToken: token, IncludeDeleted: true})
+	assert.Equal(t, ErrPageTokenIsNotMatch, err)
+}
+
+func TestParseRequest_shouldRejectZeroPageFilter(t *testing.T) {
+	_, _, err := ParseRequest(&api.ListUserRequest{PageFilter: &api.PageFilter{Page: 0, Limit: 10}})
+	assert.EqualError(t, err, "page must be > 0, page = 0")
+
+	_, _, err = ParseRequest(&api.ListUserRequest{PageFilter: &api.PageFilter{Page: 1, Limit: 0}})
+	assert.EqualError(t, err, "limit must be > 0, limit = 0")
+
+	_, _, err = ParseRequest(&api.ListUserRequest{PageFilter: &api.PageFilter{Page: 1, Limit: 10}})
+	assert.NoError(t, err)
+}
+
+func TestPageSize(t *testing.T) {
+	assert.Equal(t, uint32(DefaultPageSize), PageSize(0))
+	assert.Equal(t, uint32(10), PageSize(10))
+	assert.Equal(t, uint32(MaxPageSize), PageSize(MaxPageSize+1))
+}
+
+func TestIdLess(t *testing.T) {
+	assert.True(t, IdLess("9", "10"))
+	assert.True(t, IdLess("10", "11"))
+	assert.False(t, IdLess("11", "11"))
+	assert.False(t, IdLess("100", "99"))
+}
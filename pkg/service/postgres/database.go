@@ -2,31 +2,17 @@ package postgres
 
 import (
 	"database/sql"
-	"fmt"
-	"log"
+	"github.com/fev0ks/UserServiceSC/pkg/config"
 )
 
 const (
-	host         = "localhost"
-	dbPort       = "5432"
 	dbDriverName = "postgres"
-	dbUser       = "user"
-	dbPassword   = "password"
-	dbName       = "user_service_db"
 )
 
-func OpenDataBaseConnection() *sql.DB {
-	psqlInfo := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		host, dbPort, dbUser, dbPassword, dbName)
-	db, err := sql.Open(dbDriverName, psqlInfo)
-	if err != nil {
-		log.Fatalln(err)
-	}
-	return db
+func OpenDataBaseConnection(cfg config.DatabaseConfig) (*sql.DB, error) {
+	return sql.Open(dbDriverName, cfg.DataSourceName())
 }
 
-func CloseDataBaseConnection(db *sql.DB) {
-	if err := db.Close(); err != nil {
-		log.Fatalln(err)
-	}
+func CloseDataBaseConnection(db *sql.DB) error {
+	return db.Close()
 }
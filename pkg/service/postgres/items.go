@@ -0,0 +1,266 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"github.com/fev0ks/UserServiceSC/pkg/service/entityid"
+	"github.com/fev0ks/UserServiceSC/pkg/service/errorhandler"
+	"github.com/fev0ks/UserServiceSC/pkg/service/pagination"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
+)
+
+const (
+	SelectItemQuery = "SELECT item.id, item.name, user_item.user_id, item.created_at, item.updated_at " +
+		"FROM \"item\" item " +
+		"inner join \"user_item\" on user_item.item_id = item.id " +
+		"inner join \"user\" us on us.id = user_item.user_id " +
+		"where item.id = $1 and us.deleted_at is null; "
+	SelectItemsQuery = "SELECT item.id, item.name, user_item.user_id, item.created_at, item.updated_at " +
+		"FROM \"item\" item " +
+		"inner join \"user_item\" on user_item.item_id = item.id " +
+		"inner join \"user\" us on us.id = user_item.user_id " +
+		"where us.deleted_at is null%s order by item.id LIMIT %s; "
+	SelectUserItemIdsQuery  = "SELECT item_id FROM user_item where user_id = $1 and item_id = any($2::bigint[]); "
+	SelectOwnedItemIdsQuery = "SELECT item_id FROM user_item where user_id = $1 order by item_id; "
+	DeleteItemsQuery        = "DELETE FROM item where id = any($1::bigint[]); "
+	TouchUserQuery          = "UPDATE \"user\" set updated_at = $2, version = version + 1 where id = $1; "
+	// conditions of ListItems, %s is replaced by placeholder of query argument
+	itemUserCondition  = " and user_item.user_id = %s"
+	itemAfterCondition = " and item.id > %s"
+)
+
+func (s *Storage) AddItems(ctx context.Context, userId entityid.ID, data *api.AddItemsRequest) (*api.AddItemsResponse, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		s.log(ctx).Debug("AddItems: s.DB.BeginTx failed", zap.Error(err))
+		return nil, errorhandler.FromError(err)
+	}
+	defer tx.Rollback()
+
+	if err := s.checkUserVersion(ctx, tx, userId.String(), 0); err != nil {
+		return nil, err
+	}
+	items, err := s.createItems(ctx, tx, userId.String(), data.GetItems())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.touchUser(ctx, tx, userId.String()); err != nil {
+		return nil, errorhandler.FromError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.log(ctx).Debug("AddItems: tx.Commit failed", zap.String("user_id", userId.String()), zap.Error(err))
+		return nil, errorhandler.FromError(err)
+	}
+	return &api.AddItemsResponse{Items: items}, nil
+}
+
+// RemoveItems deletes items only when every item belongs to the user
+func (s *Storage) RemoveItems(ctx context.Context, userId entityid.ID, itemIds []entityid.ID) (*api.RemoveItemsResponse, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		s.log(ctx).Debug("RemoveItems: s.DB.BeginTx failed", zap.Error(err))
+		return nil, errorhandler.FromError(err)
+	}
+	defer tx.Rollback()
+
+	if err := s.checkUserVersion(ctx, tx, userId.String(), 0); err != nil {
+		return nil, err
+	}
+	itemIdValues := entityid.Strings(itemIds)
+	if err := s.checkItemOwner(ctx, tx, userId.String(), itemIdValues); err != nil {
+		return nil, err
+	}
+	if err := s.deleteItems(ctx, tx, itemIdValues); err != nil {
+		return nil, errorhandler.FromError(err)
+	}
+	if err := s.touchUser(ctx, tx, userId.String()); err != nil {
+		return nil, errorhandler.FromError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.log(ctx).Debug("RemoveItems: tx.Commit failed", zap.String("user_id", userId.String()), zap.Error(err))
+		return nil, errorhandler.FromError(err)
+	}
+	return &api.RemoveItemsResponse{}, nil
+}
+
+func (s *Storage) GetItem(ctx context.Context, id entityid.ID) (*api.Item, error) {
+	rows, err := queryRows(ctx, s.DB, "SelectItemQuery", SelectItemQuery, id.String())
+	if err != nil {
+		s.log(ctx).Debug("GetItem: queryRows failed", zap.String("item_id", id.String()), zap.Error(err))
+		return nil, errorhandler.FromError(err)
+	}
+	items, err := s.retrieveItems(ctx, rows)
+	if err != nil {
+		return nil, errorhandler.FromError(err)
+	}
+	if len(items) == 0 {
+		return nil, errorhandler.NewItemNotFoundError(id.String())
+	}
+	return items[0], nil
+}
+
+func (s *Storage) ListItems(ctx context.Context, userId entityid.ID, data *api.ListItemsRequest) (*api.ListItemsResponse, error) {
+	token, err := pagination.ParseItemsRequest(data)
+	if err != nil {
+		return nil, errorhandler.NewInvalidArgumentError(err.Error())
+	}
+	limit := pagination.PageSize(data.GetPageSize())
+
+	var (
+		conditions string
+		args       []interface{}
+	)
+	if !userId.IsZero() {
+		args = append(args, userId.String())
+		conditions += fmt.Sprintf(itemUserCondition, "$"+strconv.Itoa(len(args)))
+	}
+	if token.AfterId != "" {
+		args = append(args, token.AfterId)
+		conditions += fmt.Sprintf(itemAfterCondition, "$"+strconv.Itoa(len(args)))
+	}
+	// one more item is requested to find out whether the page is the last one
+	args = append(args, limit+1)
+	query := fmt.Sprintf(SelectItemsQuery, conditions, "$"+strconv.Itoa(len(args)))
+
+	rows, err := queryRows(ctx, s.DB, "SelectItemsQuery", query, args...)
+	if err != nil {
+		s.log(ctx).Debug("ListItems: queryRows failed",
+			zap.String("user_id", data.GetUserId()), zap.String("page_token", data.GetPageToken()), zap.Error(err))
+		return nil, errorhandler.FromError(err)
+	}
+	items, err := s.retrieveItems(ctx, rows)
+	if err != nil {
+		return nil, errorhandler.FromError(err)
+	}
+	response := &api.ListItemsResponse{}
+	if len(items) > int(limit) {
+		items = items[:limit]
+		response.NextPageToken = pagination.NextItemsToken(data, items[len(items)-1]).Encode()
+	}
+	response.Items = items
+	return response, nil
+}
+
+// checkItemOwner rejects item ids which do not belong to the user with NotFound listing them
+func (s *Storage) checkItemOwner(ctx context.Context, tx *sql.Tx, userId string, itemIds []string) error {
+	if len(itemIds) == 0 {
+		return nil
+	}
+	ownedIds, err := s.selectUserItemIds(ctx, tx, userId, itemIds)
+	if err != nil {
+		return errorhandler.FromError(err)
+	}
+	var foreignIds []string
+	for _, itemId := range itemIds {
+		if !ownedIds[itemId] {
+			foreignIds = append(foreignIds, itemId)
+		}
+	}
+	if len(foreignIds) > 0 {
+		return errorhandler.NewItemsNotFoundError(userId, foreignIds)
+	}
+	return nil
+}
+
+// selectUserItemIds returns which of itemIds belong to the user
+func (s *Storage) selectUserItemIds(ctx context.Context, tx *sql.Tx, userId string, itemIds []string) (map[string]bool, error) {
+	rows, err := queryRows(ctx, tx, "SelectUserItemIdsQuery", SelectUserItemIdsQuery, userId, pq.Array(itemIds))
+	if err != nil {
+		s.log(ctx).Debug("selectUserItemIds: queryRows failed", zap.String("user_id", userId), zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+	ownedIds := make(map[string]bool, len(itemIds))
+	for rows.Next() {
+		var itemId string
+		if err := rows.Scan(&itemId); err != nil {
+			s.log(ctx).Debug("selectUserItemIds: rows.Scan failed", zap.Error(err))
+			return nil, err
+		}
+		ownedIds[itemId] = true
+	}
+	return ownedIds, rows.Err()
+}
+
+// selectOwnedItemIds returns ids of every item of the user
+func (s *Storage) selectOwnedItemIds(ctx context.Context, tx *sql.Tx, userId string) ([]string, error) {
+	rows, err := queryRows(ctx, tx, "SelectOwnedItemIdsQuery", SelectOwnedItemIdsQuery, userId)
+	if err != nil {
+		s.log(ctx).Debug("selectOwnedItemIds: queryRows failed", zap.String("user_id", userId), zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+	var itemIds []string
+	for rows.Next() {
+		var itemId string
+		if err := rows.Scan(&itemId); err != nil {
+			s.log(ctx).Debug("selectOwnedItemIds: rows.Scan failed", zap.Error(err))
+			return nil, err
+		}
+		itemIds = append(itemIds, itemId)
+	}
+	return itemIds, rows.Err()
+}
+
+func (s *Storage) deleteItems(ctx context.Context, tx *sql.Tx, itemIds []string) error {
+	stmt, err := prepare(ctx, tx, "DeleteItemsQuery", DeleteItemsQuery)
+	if err != nil {
+		s.log(ctx).Debug("deleteItems: tx.Prepare failed", zap.String("query", DeleteItemsQuery), zap.Error(err))
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.ExecContext(ctx, pq.Array(itemIds))
+	if err != nil {
+		s.log(ctx).Debug("deleteItems: stmt.Exec failed", zap.Strings("item_ids", itemIds), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// touchUser marks user as updated when its items are changed
+func (s *Storage) touchUser(ctx context.Context, tx *sql.Tx, userId string) error {
+	stmt, err := prepare(ctx, tx, "TouchUserQuery", TouchUserQuery)
+	if err != nil {
+		s.log(ctx).Debug("touchUser: tx.Prepare failed", zap.String("query", TouchUserQuery), zap.Error(err))
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.ExecContext(ctx, userId, time.Now())
+	if err != nil {
+		s.log(ctx).Debug("touchUser: stmt.Exec failed", zap.String("user_id", userId), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (s *Storage) retrieveItems(ctx context.Context, rows *tracedRows) ([]*api.Item, error) {
+	items := make([]*api.Item, 0)
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			itemId        string
+			itemName      string
+			userId        string
+			itemCreatedAt pq.NullTime
+			itemUpdatedAt pq.NullTime
+		)
+		if err := rows.Scan(&itemId, &itemName, &userId, &itemCreatedAt, &itemUpdatedAt); err != nil {
+			s.log(ctx).Debug("retrieveItems: rows.Scan failed", zap.Error(err))
+			return nil, err
+		}
+		items = append(items, &api.Item{
+			Id:        itemId,
+			Name:      itemName,
+			UserId:    userId,
+			CreatedAt: getTimestamp(itemCreatedAt),
+			UpdatedAt: getTimestamp(itemUpdatedAt)})
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,195 @@
+package postgres
+
+import (
+	"fmt"
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"github.com/fev0ks/UserServiceSC/pkg/service/filterexpr"
+	"github.com/fev0ks/UserServiceSC/pkg/service/pagination"
+	"strconv"
+	"strings"
+)
+
+// conditions of ListUser, %s are replaced by placeholders of query arguments only
+const (
+	userTypeCondition      = "exists (select 1 from user_type ut where ut.user_id = us.id and ut.type_id = %s)"
+	minAgeCondition        = "us.age >= %s"
+	maxAgeCondition        = "us.age <= %s"
+	nameLikeCondition      = "us.name like %s escape '\\'"
+	createdAfterCondition  = "us.created_at >= %s"
+	createdBeforeCondition = "us.created_at < %s"
+	updatedAfterCondition  = "us.updated_at >= %s"
+	updatedBeforeCondition = "us.updated_at < %s"
+	notDeletedCondition    = "us.deleted_at is null"
+	itemNameCondition      = "exists (select 1 from user_item ui inner join item i on i.id = ui.item_id " +
+		"where ui.user_id = us.id and i.name = %s)"
+	// conditions of filter expression, %s are replaced by constant column or operator and placeholders
+	itemExistsCondition = "exists (select 1 from user_item ui inner join item i on i.id = ui.item_id " +
+		"where ui.user_id = us.id and %s)"
+	likeCondition        = "%s like %s escape '\\'"
+	restrictionCondition = "%s %s %s"
+	// conditions of users following page token
+	afterIdCondition   = "us.id > %s"
+	afterAscCondition  = "(%[1]s > %[2]s or (%[1]s = %[2]s and us.id > %[3]s))"
+	afterDescCondition = "(%[1]s < %[2]s or (%[1]s = %[2]s and us.id > %[3]s))"
+)
+
+// orderColumns are expressions of ordering fields, users which were never updated are ordered by created_at
+var orderColumns = map[string]string{
+	pagination.NameField:      "us.name",
+	pagination.AgeField:       "us.age",
+	pagination.CreatedAtField: "us.created_at",
+	pagination.UpdatedAtField: "coalesce(us.updated_at, us.created_at)",
+}
+
+// filterColumns are expressions of filterexpr fields, item fields are columns of item i of itemExistsCondition
+var filterColumns = map[string]string{
+	"id":               "us.id",
+	"name":             "us.name",
+	"age":              "us.age",
+	"user_type":        "(select ut.type_id from user_type ut where ut.user_id = us.id)",
+	"created_at":       "us.created_at",
+	"updated_at":       "us.updated_at",
+	"items.id":         "i.id",
+	"items.name":       "i.name",
+	"items.created_at": "i.created_at",
+	"items.updated_at": "i.updated_at",
+}
+
+// userListQuery collects conditions and arguments of ListUser queries, values of request never become part
+// of query text
+type userListQuery struct {
+	conditions []string
+	args       []interface{}
+}
+
+// newUserListQuery collects conditions of filters, soft deleted users are excluded unless includeDeleted is set
+func newUserListQuery(filter *api.UserFilter, expr filterexpr.Expr, includeDeleted bool) *userListQuery {
+	q := &userListQuery{}
+	if !includeDeleted {
+		q.conditions = append(q.conditions, notDeletedCondition)
+	}
+	if expr != nil {
+		q.conditions = append(q.conditions, q.filterCondition(expr))
+	}
+	if filter == nil {
+		return q
+	}
+	if filter.GetUserType() != api.UserType_INVALID_USER_TYPE {
+		q.where(userTypeCondition, filter.GetUserType())
+	}
+	if filter.MinAge != nil {
+		q.where(minAgeCondition, filter.GetMinAge())
+	}
+	if filter.MaxAge != nil {
+		q.where(maxAgeCondition, filter.GetMaxAge())
+	}
+	if filter.GetNamePrefix() != "" {
+		q.where(nameLikeCondition, escapeLike(filter.GetNamePrefix())+"%")
+	}
+	if filter.GetNameContains() != "" {
+		q.where(nameLikeCondition, "%"+escapeLike(filter.GetNameContains())+"%")
+	}
+	if filter.CreatedAfter != nil {
+		q.where(createdAfterCondition, filter.GetCreatedAfter().AsTime())
+	}
+	if filter.CreatedBefore != nil {
+		q.where(createdBeforeCondition, filter.GetCreatedBefore().AsTime())
+	}
+	if filter.UpdatedAfter != nil {
+		q.where(updatedAfterCondition, filter.GetUpdatedAfter().AsTime())
+	}
+	if filter.UpdatedBefore != nil {
+		q.where(updatedBeforeCondition, filter.GetUpdatedBefore().AsTime())
+	}
+	if filter.GetItemName() != "" {
+		q.where(itemNameCondition, filter.GetItemName())
+	}
+	return q
+}
+
+// arg adds query argument and returns its placeholder
+func (q *userListQuery) arg(value interface{}) string {
+	q.args = append(q.args, value)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+func (q *userListQuery) where(condition string, value interface{}) {
+	q.conditions = append(q.conditions, fmt.Sprintf(condition, q.arg(value)))
+}
+
+// filterCondition compiles filter expression, operators of restrictions are the only parts of it written to query
+func (q *userListQuery) filterCondition(expr filterexpr.Expr) string {
+	switch e := expr.(type) {
+	case filterexpr.And:
+		return "(" + q.filterCondition(e.Left) + " and " + q.filterCondition(e.Right) + ")"
+	case filterexpr.Or:
+		return "(" + q.filterCondition(e.Left) + " or " + q.filterCondition(e.Right) + ")"
+	case filterexpr.Not:
+		return "not " + q.filterCondition(e.Operand)
+	case filterexpr.Restriction:
+		column := filterColumns[e.Field.Name]
+		value := e.Value
+		if userType, ok := value.(api.UserType); ok {
+			value = int32(userType)
+		}
+		var condition string
+		switch {
+		case e.Operator == filterexpr.Has && !e.Field.Item:
+			condition = fmt.Sprintf(likeCondition, column, q.arg("%"+escapeLike(value.(string))+"%"))
+		case e.Operator == filterexpr.Has:
+			condition = fmt.Sprintf(restrictionCondition, column, filterexpr.Equal, q.arg(value))
+		default:
+			condition = fmt.Sprintf(restrictionCondition, column, e.Operator, q.arg(value))
+		}
+		if e.Field.Item {
+			return fmt.Sprintf(itemExistsCondition, condition)
+		}
+		if e.Field.Nullable {
+			// restriction of unset field is false, not null, so NOT of it is true as for memory storage
+			return "coalesce(" + condition + ", false)"
+		}
+		return "(" + condition + ")"
+	}
+	return "true"
+}
+
+// after returns condition of users following the page token in the order
+func (q *userListQuery) after(order pagination.Order, token pagination.Token) (string, error) {
+	if order.Field == pagination.IdField {
+		return fmt.Sprintf(afterIdCondition, q.arg(token.AfterId)), nil
+	}
+	value, err := order.ParseValue(token.AfterValue)
+	if err != nil {
+		return "", err
+	}
+	condition := afterAscCondition
+	if order.Descending {
+		condition = afterDescCondition
+	}
+	return fmt.Sprintf(condition, orderColumns[order.Field], q.arg(value), q.arg(token.AfterId)), nil
+}
+
+// whereClause joins conditions, every user matches empty filter
+func (q *userListQuery) whereClause() string {
+	if len(q.conditions) == 0 {
+		return "true"
+	}
+	return strings.Join(q.conditions, " and ")
+}
+
+// orderClause returns ORDER BY expressions of order, users with equal values are ordered by id
+func orderClause(order pagination.Order) string {
+	column, ok := orderColumns[order.Field]
+	if !ok {
+		return "us.id"
+	}
+	if order.Descending {
+		return column + " desc, us.id"
+	}
+	return column + ", us.id"
+}
+
+// escapeLike escapes wildcards of LIKE pattern, so they match themselves
+func escapeLike(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(value)
+}
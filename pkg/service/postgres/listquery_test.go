@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"github.com/fev0ks/UserServiceSC/pkg/service/filterexpr"
+	"github.com/fev0ks/UserServiceSC/pkg/service/pagination"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"testing"
+	"time"
+)
+
+func TestNewUserListQuery_shouldPassFilterValuesAsArguments(t *testing.T) {
+	createdAfter := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	minAge := int32(18)
+	filter := &api.UserFilter{
+		UserType:     api.UserType_CUSTOMER_USER_TYPE,
+		MinAge:       &minAge,
+		NamePrefix:   "50%_off'; drop table \"user\"; --",
+		CreatedAfter: timestamppb.New(createdAfter),
+		ItemName:     "laptop",
+	}
+
+	q := newUserListQuery(filter, nil, true)
+
+	assert.Equal(t, "exists (select 1 from user_type ut where ut.user_id = us.id and ut.type_id = $1) and "+
+		"us.age >= $2 and "+
+		"us.name like $3 escape '\\' and "+
+		"us.created_at >= $4 and "+
+		"exists (select 1 from user_item ui inner join item i on i.id = ui.item_id where ui.user_id = us.id and i.name = $5)",
+		q.whereClause())
+	assert.Equal(t, []interface{}{
+		api.UserType_CUSTOMER_USER_TYPE,
+		minAge,
+		"50\\%\\_off'; drop table \"user\"; --%",
+		createdAfter,
+		"laptop",
+	}, q.args)
+}
+
+func TestNewUserListQuery_shouldExcludeDeletedUsers(t *testing.T) {
+	assert.Equal(t, "us.deleted_at is null", newUserListQuery(nil, nil, false).whereClause())
+	assert.Equal(t, "true", newUserListQuery(nil, nil, true).whereClause())
+
+	maxAge := int32(60)
+	q := newUserListQuery(&api.UserFilter{MaxAge: &maxAge}, nil, false)
+	assert.Equal(t, "us.deleted_at is null and us.age <= $1", q.whereClause())
+	assert.Equal(t, []interface{}{maxAge}, q.args)
+}
+
+func TestUserListQuery_after(t *testing.T) {
+	testCases := []struct {
+		caseName          string
+		orderBy           string
+		token             pagination.Token
+		expectedCondition string
+		expectedArgs      []interface{}
+	}{
+		{
+			caseName:          "Ordered by id",
+			orderBy:           "",
+			token:             pagination.Token{AfterId: "42"},
+			expectedCondition: "us.id > $1",
+			expectedArgs:      []interface{}{"42"},
+		},
+		{
+			caseName:          "Ordered by age",
+			orderBy:           "age",
+			token:             pagination.Token{AfterId: "42", AfterValue: "30"},
+			expectedCondition: "(us.age > $1 or (us.age = $1 and us.id > $2))",
+			expectedArgs:      []interface{}{int32(30), "42"},
+		},
+		{
+			caseName:          "Ordered by updated_at descending",
+			orderBy:           "updated_at desc",
+			token:             pagination.Token{AfterId: "42", AfterValue: "2021-05-01T10:00:00.123456Z"},
+			expectedCondition: "(coalesce(us.updated_at, us.created_at) < $1 or (coalesce(us.updated_at, us.created_at) = $1 and us.id > $2))",
+			expectedArgs:      []interface{}{time.Date(2021, 5, 1, 10, 0, 0, 123456000, time.UTC), "42"},
+		},
+	}
+
+	for i := range testCases {
+		tc := &testCases[i]
+		t.Run(tc.caseName, func(t *testing.T) {
+			order, err := pagination.ParseOrderBy(tc.orderBy)
+			assert.NoError(t, err)
+			q := newUserListQuery(nil, nil, true)
+
+			condition, err := q.after(order, tc.token)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedCondition, condition)
+			assert.Equal(t, tc.expectedArgs, q.args)
+		})
+	}
+}
+
+func TestOrderClause(t *testing.T) {
+	assert.Equal(t, "us.id", orderClause(pagination.Order{Field: pagination.IdField}))
+	assert.Equal(t, "us.name, us.id", orderClause(pagination.Order{Field: pagination.NameField}))
+	assert.Equal(t, "us.age desc, us.id", orderClause(pagination.Order{Field: pagination.AgeField, Descending: true}))
+}
+
+func TestUserListQuery_filterCondition(t *testing.T) {
+	expr, err := filterexpr.Parse(`user_type = CUSTOMER_USER_TYPE AND (age >= 18 OR name:"50%") AND NOT updated_at > "2021-05-01T00:00:00Z" AND items.name:"laptop"`)
+	assert.NoError(t, err)
+
+	q := newUserListQuery(nil, expr, true)
+
+	assert.Equal(t, "((("+
+		"((select ut.type_id from user_type ut where ut.user_id = us.id) = $1) and "+
+		"((us.age >= $2) or (us.name like $3 escape '\\'))) and "+
+		"not coalesce(us.updated_at > $4, false)) and "+
+		"exists (select 1 from user_item ui inner join item i on i.id = ui.item_id where ui.user_id = us.id and i.name = $5))",
+		q.whereClause())
+	assert.Equal(t, []interface{}{
+		int32(api.UserType_CUSTOMER_USER_TYPE),
+		int64(18),
+		"%50\\%%",
+		time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC),
+		"laptop",
+	}, q.args)
+}
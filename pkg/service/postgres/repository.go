@@ -1,11 +1,17 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"github.com/fev0ks/UserServiceSC/pkg/service/entityid"
 	"github.com/fev0ks/UserServiceSC/pkg/service/errorhandler"
+	"github.com/fev0ks/UserServiceSC/pkg/service/filterexpr"
+	"github.com/fev0ks/UserServiceSC/pkg/service/pagination"
+	"github.com/fev0ks/UserServiceSC/pkg/service/updatemask"
 	"github.com/lib/pq"
+	"go.uber.org/zap"
 	"google.golang.org/protobuf/types/known/timestamppb"
 	"strconv"
 	"strings"
@@ -13,87 +19,98 @@ import (
 )
 
 const (
-	InsertUserQuery     = "INSERT INTO \"user\"(name, age) VALUES($1, $2) RETURNING id, created_at; "
+	InsertUserQuery     = "INSERT INTO \"user\"(name, age) VALUES($1, $2) RETURNING id, created_at, version; "
 	InsertItemQuery     = "INSERT INTO \"item\"(name) VALUES %s RETURNING id, name, created_at; "
 	InsertUserTypeQuery = "INSERT INTO user_type(user_id, type_id) VALUES($1, $2); "
 	InsertUserItemQuery = "INSERT INTO user_item(user_id, item_id) VALUES %s; "
 	SelectUserQuery     = "SELECT " +
-		"us.id, us.name userName, us.age userAge, type_id userType, us.created_at userCreatedAt, us.updated_at userUpdatedAt, " +
+		"us.id, us.name userName, us.age userAge, type_id userType, us.created_at userCreatedAt, us.updated_at userUpdatedAt, us.version userVersion, us.deleted_at userDeletedAt, " +
 		"item.id itemId, item.name itemName, item.created_at itemCreatedAt, item.updated_at itemUpdatedAt " +
 		"FROM \"user\" us " +
 		"inner join \"user_type\" on user_type.user_id = us.id " +
 		"left join \"user_item\" on user_item.user_id = us.id " +
 		"left join \"item\" item on user_item.item_id = item.id " +
-		"where us.id = $1; "
+		"where us.id = $1 and us.deleted_at is null order by item.id; "
 	SelectUsersQuery = "SELECT " +
-		"us.id, us.name userName, us.age userAge, type_id userType, us.created_at userCreatedAt, us.updated_at userUpdatedAt, " +
+		"us.id, us.name userName, us.age userAge, type_id userType, us.created_at userCreatedAt, us.updated_at userUpdatedAt, us.version userVersion, us.deleted_at userDeletedAt, " +
 		"item.id itemId, item.name itemName, item.created_at itemCreatedAt, item.updated_at itemUpdatedAt " +
 		"FROM \"user\" us \ninner join \"user_type\" on user_type.user_id = us.id " +
 		"left join \"user_item\" on user_item.user_id = us.id " +
 		"left join \"item\" item on user_item.item_id = item.id " +
 		"where " +
-		"us.id in (select id from \"user\" order by id LIMIT $1 OFFSET $2) " +
-		"order by us.id"
+		"us.id in (select us.id from \"user\" us where %s order by %s LIMIT %s OFFSET %s) " +
+		"order by %s, item.id"
+	SelectUsersAfterQuery = "SELECT " +
+		"us.id, us.name userName, us.age userAge, type_id userType, us.created_at userCreatedAt, us.updated_at userUpdatedAt, us.version userVersion, us.deleted_at userDeletedAt, " +
+		"item.id itemId, item.name itemName, item.created_at itemCreatedAt, item.updated_at itemUpdatedAt " +
+		"FROM \"user\" us \ninner join \"user_type\" on user_type.user_id = us.id " +
+		"left join \"user_item\" on user_item.user_id = us.id " +
+		"left join \"item\" item on user_item.item_id = item.id " +
+		"where " +
+		"us.id in (select us.id from \"user\" us where %s order by %s LIMIT %s) " +
+		"order by %s, item.id"
+	CountUsersQuery     = "SELECT count(*), count(*) filter (where %s) FROM \"user\" us where %s; "
 	DeleteItemQuery     = "DELETE FROM item where id in (select item_id from user_item where user_id = $1); "
 	DeleteUserQuery     = "DELETE FROM \"user\" where id = $1; "
-	UpdateUserQuery     = "UPDATE \"user\" set name = $2, age = $3, updated_at = $4 where id = $1; "
-	UpdateItemQuery     = "UPDATE \"item\" set name = %s, updated_at = %s where id = %s; "
+	SoftDeleteUserQuery = "UPDATE \"user\" set deleted_at = $2, version = version + 1 where id = $1 and deleted_at is null; "
+	RestoreUserQuery    = "UPDATE \"user\" set deleted_at = null, version = version + 1 where id = $1; "
+	UpdateUserQuery     = "UPDATE \"user\" set %s where id = $1; "
+	UpdateItemQuery     = "UPDATE \"item\" set name = $2, updated_at = $3 where id = $1; "
 	UpdateUserTypeQuery = "UPDATE \"user_type\" set type_id = $2 where user_id = $1; "
+	// SelectUserVersionQuery locks the user until the end of transaction, so version can't be changed concurrently
+	SelectUserVersionQuery = "SELECT version, deleted_at FROM \"user\" where id = $1 FOR UPDATE; "
 )
 
-var StorageInstance *Storage
-
-func CreateUser(data *api.CreateUserRequest) (*api.User, error) {
-
-	tx, err := StorageInstance.DB.Begin()
+func (s *Storage) CreateUser(ctx context.Context, data *api.CreateUserRequest) (*api.User, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
-		errorhandler.LogMsg("CreateUser: StorageInstance.DB.Begin")
-		return nil, errorhandler.NewInternalError(err.Error())
+		s.log(ctx).Debug("CreateUser: s.DB.BeginTx failed", zap.Error(err))
+		return nil, errorhandler.FromError(err)
 	}
 	defer tx.Rollback()
 
-	user, err := createUser(tx, data.GetName(), data.GetAge(), data.GetUserType())
+	user, err := s.createUser(ctx, tx, data.GetName(), data.GetAge(), data.GetUserType())
 	if err != nil {
-		errorhandler.LogMsg("CreateUser: createUser")
-		return nil, errorhandler.NewInternalError(err.Error())
+		s.log(ctx).Debug("CreateUser: createUser failed", zap.Error(err))
+		return nil, errorhandler.FromError(err)
 	}
 
-	items, err := createItems(tx, user.Id, data.GetItems())
+	items, err := s.createItems(ctx, tx, user.Id, data.GetItems())
 	if err != nil {
-		errorhandler.LogMsg("CreateUser: createItems")
-		return nil, errorhandler.NewInternalError(err.Error())
+		s.log(ctx).Debug("CreateUser: createItems failed", zap.String("user_id", user.Id), zap.Error(err))
+		return nil, errorhandler.FromError(err)
 	}
 	user.Items = items
 
 	if err := tx.Commit(); err != nil {
-		errorhandler.LogMsg("CreateUser: tx.Commit")
-		return nil, errorhandler.NewInternalError(err.Error())
+		s.log(ctx).Debug("CreateUser: tx.Commit failed", zap.String("user_id", user.Id), zap.Error(err))
+		return nil, errorhandler.FromError(err)
 	}
 	return user, nil
 }
 
-func createUser(tx *sql.Tx, name string, age int32, userType api.UserType) (*api.User, error) {
+func (s *Storage) createUser(ctx context.Context, tx *sql.Tx, name string, age int32, userType api.UserType) (*api.User, error) {
 	var (
 		userId    string
 		createdAt time.Time
+		version   int64
 	)
 
-	stmt, err := tx.Prepare(InsertUserQuery)
+	stmt, err := prepare(ctx, tx, "InsertUserQuery", InsertUserQuery)
 	if err != nil {
-		errorhandler.LogMsg("CreateUser: tx.Prepare(InsertUserQuery)")
-		return nil, errorhandler.NewInternalError(err.Error())
+		s.log(ctx).Debug("createUser: tx.Prepare failed", zap.String("query", InsertUserQuery), zap.Error(err))
+		return nil, errorhandler.FromError(err)
 	}
 
 	defer stmt.Close()
-	err = stmt.QueryRow(name, age).Scan(&userId, &createdAt)
+	err = stmt.QueryRowContext(ctx, name, age).Scan(&userId, &createdAt, &version)
 	if err != nil {
-		errorhandler.LogMsg("CreateUser: stmt.QueryRow")
-		return nil, errorhandler.NewInternalError(err.Error())
+		s.log(ctx).Debug("createUser: stmt.QueryRow failed", zap.String("query", InsertUserQuery), zap.Error(err))
+		return nil, errorhandler.FromError(err)
 	}
 
-	if err = setUserType(tx, userId, userType); err != nil {
-		errorhandler.LogMsg("CreateUser: setUserType")
-		return nil, errorhandler.NewInternalError(err.Error())
+	if err = s.setUserType(ctx, tx, userId, userType); err != nil {
+		return nil, errorhandler.FromError(err)
 	}
 
 	return &api.User{
@@ -102,25 +119,27 @@ func createUser(tx *sql.Tx, name string, age int32, userType api.UserType) (*api
 			Age:       age,
 			UserType:  userType,
 			CreatedAt: timestamppb.New(createdAt),
-			UpdatedAt: nil},
+			UpdatedAt: nil,
+			Version:   version},
 		nil
 }
 
-func setUserType(tx *sql.Tx, userId string, userType api.UserType) error {
-	stmt, err := tx.Prepare(InsertUserTypeQuery)
+func (s *Storage) setUserType(ctx context.Context, tx *sql.Tx, userId string, userType api.UserType) error {
+	stmt, err := prepare(ctx, tx, "InsertUserTypeQuery", InsertUserTypeQuery)
 	if err != nil {
-		errorhandler.LogMsg(fmt.Sprintf("setUserType: tx.Prepare(%s)", InsertUserTypeQuery))
+		s.log(ctx).Debug("setUserType: tx.Prepare failed", zap.String("query", InsertUserTypeQuery), zap.Error(err))
 		return err
 	}
 	defer stmt.Close()
-	if _, err = stmt.Exec(userId, userType); err != nil {
-		errorhandler.LogMsg(fmt.Sprintf("setUserType: stmt.Exec(%s, %v)", userId, userType))
+	if _, err = stmt.ExecContext(ctx, userId, userType); err != nil {
+		s.log(ctx).Debug("setUserType: stmt.Exec failed",
+			zap.String("user_id", userId), zap.Stringer("user_type", userType), zap.Error(err))
 		return err
 	}
 	return nil
 }
 
-func createItems(tx *sql.Tx, userId string, data []*api.CreateItemRequest) ([]*api.Item, error) {
+func (s *Storage) createItems(ctx context.Context, tx *sql.Tx, userId string, data []*api.CreateItemRequest) ([]*api.Item, error) {
 	if len(data) > 0 {
 		var items = make([]*api.Item, 0, len(data))
 		valueStrings := make([]string, 0, len(items))
@@ -132,17 +151,17 @@ func createItems(tx *sql.Tx, userId string, data []*api.CreateItemRequest) ([]*a
 			i++
 		}
 		query := fmt.Sprintf(InsertItemQuery, strings.Join(valueStrings, ","))
-		stmt, err := tx.Prepare(query)
+		stmt, err := prepare(ctx, tx, "InsertItemQuery", query)
 		if err != nil {
-			errorhandler.LogMsg(fmt.Sprintf("createItems: tx.Prepare(%s)", query))
-			return nil, errorhandler.NewInternalError(err.Error())
+			s.log(ctx).Debug("createItems: tx.Prepare failed", zap.String("query", query), zap.Error(err))
+			return nil, errorhandler.FromError(err)
 		}
 
 		defer stmt.Close()
-		rows, err := stmt.Query(valueArgs...)
+		rows, err := stmt.QueryContext(ctx, valueArgs...)
 		if err != nil {
-			errorhandler.LogMsg(fmt.Sprintf("createItems: tmt.Query(%v)", valueArgs))
-			return nil, errorhandler.NewInternalError(err.Error())
+			s.log(ctx).Debug("createItems: stmt.Query failed", zap.String("query", query), zap.Error(err))
+			return nil, errorhandler.FromError(err)
 		}
 		defer rows.Close()
 		for rows.Next() {
@@ -153,8 +172,8 @@ func createItems(tx *sql.Tx, userId string, data []*api.CreateItemRequest) ([]*a
 			)
 			err := rows.Scan(&itemId, &name, &createdAt)
 			if err != nil {
-				errorhandler.LogMsg("createItems: rows.Scan")
-				return nil, errorhandler.NewInternalError(err.Error())
+				s.log(ctx).Debug("createItems: rows.Scan failed", zap.Error(err))
+				return nil, errorhandler.FromError(err)
 			}
 			items = append(
 				items,
@@ -164,10 +183,9 @@ func createItems(tx *sql.Tx, userId string, data []*api.CreateItemRequest) ([]*a
 					UserId:    userId,
 					CreatedAt: timestamppb.New(createdAt)})
 		}
-		err = setUserItem(tx, userId, items)
+		err = s.setUserItem(ctx, tx, userId, items)
 		if err != nil {
-			errorhandler.LogMsg("createItems: setUserItem")
-			return nil, errorhandler.NewInternalError(err.Error())
+			return nil, errorhandler.FromError(err)
 		}
 		return items, nil
 	} else {
@@ -175,7 +193,7 @@ func createItems(tx *sql.Tx, userId string, data []*api.CreateItemRequest) ([]*a
 	}
 }
 
-func setUserItem(tx *sql.Tx, userId string, items []*api.Item) error {
+func (s *Storage) setUserItem(ctx context.Context, tx *sql.Tx, userId string, items []*api.Item) error {
 	valueStrings := make([]string, 0, len(items))
 	valueArgs := make([]interface{}, 0, len(items))
 	i := 0
@@ -186,215 +204,516 @@ func setUserItem(tx *sql.Tx, userId string, items []*api.Item) error {
 		i++
 	}
 	query := fmt.Sprintf(InsertUserItemQuery, strings.Join(valueStrings, ","))
-	stmt, err := tx.Prepare(query)
+	stmt, err := prepare(ctx, tx, "InsertUserItemQuery", query)
+	if err != nil {
+		s.log(ctx).Debug("setUserItem: tx.Prepare failed", zap.String("query", query), zap.Error(err))
+		return err
+	}
 	defer stmt.Close()
-	_, err = stmt.Exec(valueArgs...)
+	_, err = stmt.ExecContext(ctx, valueArgs...)
 	if err != nil {
-		errorhandler.LogMsg(fmt.Sprintf("setUserItem: stmt.Exec(%v)", valueArgs))
+		s.log(ctx).Debug("setUserItem: stmt.Exec failed", zap.String("user_id", userId), zap.Error(err))
 		return err
 	}
 	return nil
 }
 
-func UpdateUser(data *api.UpdateUserRequest) (*api.User, error) {
-	tx, err := StorageInstance.DB.Begin()
+func (s *Storage) UpdateUser(ctx context.Context, id entityid.ID, data *api.UpdateUserRequest) (*api.User, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
-		errorhandler.LogMsg("UpdateUser: StorageInstance.DB.Begin")
-		return nil, errorhandler.NewInternalError(err.Error())
+		s.log(ctx).Debug("UpdateUser: s.DB.BeginTx failed", zap.Error(err))
+		return nil, errorhandler.FromError(err)
 	}
 	defer tx.Rollback()
 
-	err = updateUser(tx, data)
+	mask, err := updatemask.ParseUserMask(data.GetUpdateMask())
 	if err != nil {
-		errorhandler.LogMsg("UpdateUser: updateUser")
-		return nil, errorhandler.NewInternalError(err.Error())
+		return nil, errorhandler.NewInvalidArgumentError(err.Error())
 	}
 
-	err = updateUserType(tx, data.GetId(), data.GetUserType())
-	if err != nil {
-		errorhandler.LogMsg("UpdateUser: updateUserType")
-		return nil, errorhandler.NewInternalError(err.Error())
+	if err := s.checkUserVersion(ctx, tx, id.String(), data.GetVersion()); err != nil {
+		return nil, err
+	}
+	if mask.Items || mask.ItemNames {
+		if err := s.checkItemOwner(ctx, tx, id.String(), updatedItemIds(data.GetItems())); err != nil {
+			return nil, err
+		}
 	}
-	err = updateItems(tx, data.GetItems())
+
+	err = s.updateUser(ctx, tx, id, data, mask)
 	if err != nil {
-		errorhandler.LogMsg("UpdateUser: createItems")
-		return nil, errorhandler.NewInternalError(err.Error())
+		return nil, errorhandler.FromError(err)
 	}
 
-	if err := tx.Commit(); err != nil {
-		errorhandler.LogMsg("UpdateUser: tx.Commit")
-		return nil, errorhandler.NewInternalError(err.Error())
+	if mask.UserType {
+		err = s.updateUserType(ctx, tx, id.String(), data.GetUserType())
+		if err != nil {
+			return nil, errorhandler.FromError(err)
+		}
+	}
+	if mask.Items {
+		if err := s.replaceItems(ctx, tx, id.String(), data.GetItems()); err != nil {
+			return nil, err
+		}
+	}
+	if mask.ItemNames {
+		if err := s.updateItems(ctx, tx, data.GetItems()); err != nil {
+			return nil, errorhandler.FromError(err)
+		}
 	}
 
-	user, err := getUserById(data.GetId())
+	// updated user is read in the transaction, so response does not include writes committed after it
+	user, err := s.getUserById(ctx, tx, id.String())
 	if err != nil {
-		errorhandler.LogMsg("UpdateUser: getUserById")
-		return nil, errorhandler.NewInternalError(err.Error())
+		return nil, err
 	}
 
+	if err := tx.Commit(); err != nil {
+		s.log(ctx).Debug("UpdateUser: tx.Commit failed", zap.String("user_id", id.String()), zap.Error(err))
+		return nil, errorhandler.FromError(err)
+	}
 	return user, nil
 }
 
-func updateUser(tx *sql.Tx, data *api.UpdateUserRequest) error {
-	stmt, err := tx.Prepare(UpdateUserQuery)
+// updateUser writes masked columns of user, updated_at and version are changed on every update
+func (s *Storage) updateUser(ctx context.Context, tx *sql.Tx, id entityid.ID, data *api.UpdateUserRequest, mask updatemask.UserMask) error {
+	columns := make([]string, 0, 4)
+	args := []interface{}{id.String()}
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		columns = append(columns, column+" = $"+strconv.Itoa(len(args)))
+	}
+	if mask.Name {
+		set("name", data.GetName())
+	}
+	if mask.Age {
+		set("age", data.GetAge())
+	}
+	set("updated_at", time.Now())
+	columns = append(columns, "version = version + 1")
+	query := fmt.Sprintf(UpdateUserQuery, strings.Join(columns, ", "))
+
+	stmt, err := prepare(ctx, tx, "UpdateUserQuery", query)
 	if err != nil {
-		errorhandler.LogMsg(fmt.Sprintf("updateUser: tx.Prepare(%s)", UpdateUserTypeQuery))
+		s.log(ctx).Debug("updateUser: tx.Prepare failed", zap.String("query", query), zap.Error(err))
 		return err
 	}
 	defer stmt.Close()
-	_, err = stmt.Exec(data.GetId(), data.GetName(), data.GetAge(), time.Now())
+	result, err := stmt.ExecContext(ctx, args...)
 	if err != nil {
-		errorhandler.LogMsg("updateUser: row.Scan")
+		s.log(ctx).Debug("updateUser: stmt.Exec failed", zap.String("user_id", id.String()), zap.Error(err))
 		return err
 	}
-	return nil
+	return checkAffectedUser(result, id.String())
 }
 
-func updateUserType(tx *sql.Tx, userId string, newTypeId api.UserType) error {
-	stmt, err := tx.Prepare(UpdateUserTypeQuery)
+func (s *Storage) updateUserType(ctx context.Context, tx *sql.Tx, userId string, newTypeId api.UserType) error {
+	stmt, err := prepare(ctx, tx, "UpdateUserTypeQuery", UpdateUserTypeQuery)
 	if err != nil {
-		errorhandler.LogMsg(fmt.Sprintf("updateItems: tx.Prepare(%s)", UpdateUserTypeQuery))
+		s.log(ctx).Debug("updateUserType: tx.Prepare failed", zap.String("query", UpdateUserTypeQuery), zap.Error(err))
 		return err
 	}
 	defer stmt.Close()
-	_, err = stmt.Exec(userId, newTypeId)
+	result, err := stmt.ExecContext(ctx, userId, newTypeId)
 	if err != nil {
-		errorhandler.LogMsg(fmt.Sprintf("setUserItem: stmt.Exec(%s, %s)", userId, newTypeId))
+		s.log(ctx).Debug("updateUserType: stmt.Exec failed",
+			zap.String("user_id", userId), zap.Stringer("user_type", newTypeId), zap.Error(err))
 		return err
 	}
-	return nil
+	return checkAffectedUser(result, userId)
 }
 
-func updateItems(tx *sql.Tx, data []*api.UpdateItemRequest) error {
-	if len(data) > 0 {
-		var items = make([]*api.Item, 0, len(data))
-		valueArgs := make([]interface{}, 0, len(items))
-		query := ""
-		i := 0
-		for _, item := range data {
-			query += fmt.Sprintf(UpdateItemQuery, "$"+strconv.Itoa(i*2+2), "$"+strconv.Itoa(i*2+3), "$"+strconv.Itoa(i*2+1))
-			valueArgs = append(valueArgs, item.Id, item.Name, time.Now())
-			i++
+// replaceItems creates items without id, updates items with id and deletes owned items missing in data
+func (s *Storage) replaceItems(ctx context.Context, tx *sql.Tx, userId string, data []*api.UpdateItemRequest) error {
+	ownedIds, err := s.selectOwnedItemIds(ctx, tx, userId)
+	if err != nil {
+		return errorhandler.FromError(err)
+	}
+	var (
+		keptIds    = make(map[string]bool, len(data))
+		newItems   []*api.CreateItemRequest
+		updated    []*api.UpdateItemRequest
+		removedIds []string
+	)
+	for _, item := range data {
+		if item.GetId() == "" {
+			newItems = append(newItems, &api.CreateItemRequest{Name: item.GetName()})
+		} else {
+			updated = append(updated, item)
+			keptIds[item.GetId()] = true
 		}
-		stmt, err := tx.Prepare(query)
-		if err != nil {
-			errorhandler.LogMsg(fmt.Sprintf("updateItems: tx.Prepare(%s)", query))
-			return err
+	}
+	for _, itemId := range ownedIds {
+		if !keptIds[itemId] {
+			removedIds = append(removedIds, itemId)
+		}
+	}
+	if len(removedIds) > 0 {
+		if err := s.deleteItems(ctx, tx, removedIds); err != nil {
+			return errorhandler.FromError(err)
 		}
+	}
+	if err := s.updateItems(ctx, tx, updated); err != nil {
+		return errorhandler.FromError(err)
+	}
+	_, err = s.createItems(ctx, tx, userId, newItems)
+	return err
+}
 
-		defer stmt.Close()
-		_, err = stmt.Exec(valueArgs...)
+// updatedItemIds returns ids of existing items of the request, items without id are new ones
+func updatedItemIds(data []*api.UpdateItemRequest) []string {
+	itemIds := make([]string, 0, len(data))
+	for _, item := range data {
+		if item.GetId() != "" {
+			itemIds = append(itemIds, item.GetId())
+		}
+	}
+	return itemIds
+}
+
+func (s *Storage) updateItems(ctx context.Context, tx *sql.Tx, data []*api.UpdateItemRequest) error {
+	if len(data) == 0 {
+		return nil
+	}
+	stmt, err := prepare(ctx, tx, "UpdateItemQuery", UpdateItemQuery)
+	if err != nil {
+		s.log(ctx).Debug("updateItems: tx.Prepare failed", zap.String("query", UpdateItemQuery), zap.Error(err))
+		return err
+	}
+	defer stmt.Close()
+	now := time.Now()
+	for _, item := range data {
+		_, err = stmt.ExecContext(ctx, item.GetId(), item.GetName(), now)
 		if err != nil {
-			errorhandler.LogMsg(fmt.Sprintf("updateItems: stmt.Query(%v)", valueArgs))
+			s.log(ctx).Debug("updateItems: stmt.Exec failed", zap.String("item_id", item.GetId()), zap.Error(err))
 			return err
 		}
 	}
 	return nil
 }
 
-func DeleteUser(data *api.DeleteUserRequest) (*api.DeleteUserResponse, error) {
-	tx, err := StorageInstance.DB.Begin()
+func (s *Storage) DeleteUser(ctx context.Context, id entityid.ID, data *api.DeleteUserRequest) (*api.DeleteUserResponse, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
-		errorhandler.LogMsg("UpdateUser: StorageInstance.DB.Begin")
-		return nil, errorhandler.NewInternalError(err.Error())
+		s.log(ctx).Debug("DeleteUser: s.DB.BeginTx failed", zap.Error(err))
+		return nil, errorhandler.FromError(err)
 	}
 	defer tx.Rollback()
 
-	if err := deleteItem(tx, data.Id); err != nil {
-		errorhandler.LogMsg(fmt.Sprintf("DeleteUser: deleteItem(tx, %s)", data.Id))
+	if err := s.checkUserVersion(ctx, tx, id.String(), data.GetVersion()); err != nil {
 		return nil, err
 	}
-	if err := deleteUser(tx, data.Id); err != nil {
-		errorhandler.LogMsg(fmt.Sprintf("DeleteUser: deleteItem(tx, %s)", data.Id))
-		return nil, err
+	if err := s.softDeleteUser(ctx, tx, id.String()); err != nil {
+		return nil, errorhandler.FromError(err)
 	}
 
 	if err := tx.Commit(); err != nil {
-		errorhandler.LogMsg("DeleteUser: tx.Commit")
-		return nil, errorhandler.NewInternalError(err.Error())
+		s.log(ctx).Debug("DeleteUser: tx.Commit failed", zap.String("user_id", id.String()), zap.Error(err))
+		return nil, errorhandler.FromError(err)
 	}
 	return &api.DeleteUserResponse{}, nil
 }
 
-func deleteUser(tx *sql.Tx, userId string) error {
-	stmt, err := tx.Prepare(DeleteUserQuery)
+// softDeleteUser hides the user, items are kept until the user is purged
+func (s *Storage) softDeleteUser(ctx context.Context, tx *sql.Tx, userId string) error {
+	stmt, err := prepare(ctx, tx, "SoftDeleteUserQuery", SoftDeleteUserQuery)
 	if err != nil {
-		errorhandler.LogMsg(fmt.Sprintf("deleteUser: tx.Prepare(%s)", DeleteItemQuery))
+		s.log(ctx).Debug("softDeleteUser: tx.Prepare failed", zap.String("query", SoftDeleteUserQuery), zap.Error(err))
 		return err
 	}
 	defer stmt.Close()
-	_, err = stmt.Exec(userId)
+	result, err := stmt.ExecContext(ctx, userId, time.Now())
 	if err != nil {
-		errorhandler.LogMsg(fmt.Sprintf("deleteUser: stmtUser.Exec(%s)", userId))
+		s.log(ctx).Debug("softDeleteUser: stmt.Exec failed", zap.String("user_id", userId), zap.Error(err))
 		return err
 	}
+	return checkAffectedUser(result, userId)
+}
+
+func (s *Storage) RestoreUser(ctx context.Context, id entityid.ID, data *api.RestoreUserRequest) (*api.User, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		s.log(ctx).Debug("RestoreUser: s.DB.BeginTx failed", zap.Error(err))
+		return nil, errorhandler.FromError(err)
+	}
+	defer tx.Rollback()
+
+	if err := s.checkDeletedUserVersion(ctx, tx, id.String(), data.GetVersion()); err != nil {
+		return nil, err
+	}
+	stmt, err := prepare(ctx, tx, "RestoreUserQuery", RestoreUserQuery)
+	if err != nil {
+		s.log(ctx).Debug("RestoreUser: tx.Prepare failed", zap.String("query", RestoreUserQuery), zap.Error(err))
+		return nil, errorhandler.FromError(err)
+	}
+	defer stmt.Close()
+	if _, err = stmt.ExecContext(ctx, id.String()); err != nil {
+		s.log(ctx).Debug("RestoreUser: stmt.Exec failed", zap.String("user_id", id.String()), zap.Error(err))
+		return nil, errorhandler.FromError(err)
+	}
+
+	user, err := s.getUserById(ctx, tx, id.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.log(ctx).Debug("RestoreUser: tx.Commit failed", zap.String("user_id", id.String()), zap.Error(err))
+		return nil, errorhandler.FromError(err)
+	}
+	return user, nil
+}
+
+// PurgeUser permanently removes soft deleted user with its items
+func (s *Storage) PurgeUser(ctx context.Context, id entityid.ID, data *api.PurgeUserRequest) (*api.PurgeUserResponse, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		s.log(ctx).Debug("PurgeUser: s.DB.BeginTx failed", zap.Error(err))
+		return nil, errorhandler.FromError(err)
+	}
+	defer tx.Rollback()
+
+	if err := s.checkDeletedUserVersion(ctx, tx, id.String(), data.GetVersion()); err != nil {
+		return nil, err
+	}
+	if err := s.deleteItem(ctx, tx, id.String()); err != nil {
+		return nil, errorhandler.FromError(err)
+	}
+	if err := s.deleteUser(ctx, tx, id.String()); err != nil {
+		return nil, errorhandler.FromError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.log(ctx).Debug("PurgeUser: tx.Commit failed", zap.String("user_id", id.String()), zap.Error(err))
+		return nil, errorhandler.FromError(err)
+	}
+	return &api.PurgeUserResponse{}, nil
+}
+
+// lockUser locks the user until the end of transaction and returns its version and deleted_at
+func (s *Storage) lockUser(ctx context.Context, tx *sql.Tx, userId string) (int64, pq.NullTime, error) {
+	var (
+		version   int64
+		deletedAt pq.NullTime
+	)
+	stmt, err := prepare(ctx, tx, "SelectUserVersionQuery", SelectUserVersionQuery)
+	if err != nil {
+		s.log(ctx).Debug("lockUser: tx.Prepare failed", zap.String("query", SelectUserVersionQuery), zap.Error(err))
+		return 0, deletedAt, errorhandler.FromError(err)
+	}
+	defer stmt.Close()
+	err = stmt.QueryRowContext(ctx, userId).Scan(&version, &deletedAt)
+	if err == sql.ErrNoRows {
+		return 0, deletedAt, errorhandler.NewUserNotFoundError(userId)
+	}
+	if err != nil {
+		s.log(ctx).Debug("lockUser: stmt.QueryRow failed", zap.String("user_id", userId), zap.Error(err))
+		return 0, deletedAt, errorhandler.FromError(err)
+	}
+	return version, deletedAt, nil
+}
+
+// checkUserVersion locks not deleted user and compares its version with expected one, 0 version is not compared
+func (s *Storage) checkUserVersion(ctx context.Context, tx *sql.Tx, userId string, version int64) error {
+	currentVersion, deletedAt, err := s.lockUser(ctx, tx, userId)
+	if err != nil {
+		return err
+	}
+	if deletedAt.Valid {
+		return errorhandler.NewUserNotFoundError(userId)
+	}
+	if version != 0 && version != currentVersion {
+		return errorhandler.NewVersionMismatchError(userId, version, currentVersion)
+	}
+	return nil
+}
+
+// checkDeletedUserVersion locks soft deleted user and compares its version with expected one
+func (s *Storage) checkDeletedUserVersion(ctx context.Context, tx *sql.Tx, userId string, version int64) error {
+	currentVersion, deletedAt, err := s.lockUser(ctx, tx, userId)
+	if err != nil {
+		return err
+	}
+	if !deletedAt.Valid {
+		return errorhandler.NewFailedPreconditionError(fmt.Sprintf("User %s is not deleted", userId))
+	}
+	if version != 0 && version != currentVersion {
+		return errorhandler.NewVersionMismatchError(userId, version, currentVersion)
+	}
+	return nil
+}
+
+func (s *Storage) deleteUser(ctx context.Context, tx *sql.Tx, userId string) error {
+	stmt, err := prepare(ctx, tx, "DeleteUserQuery", DeleteUserQuery)
+	if err != nil {
+		s.log(ctx).Debug("deleteUser: tx.Prepare failed", zap.String("query", DeleteUserQuery), zap.Error(err))
+		return err
+	}
+	defer stmt.Close()
+	result, err := stmt.ExecContext(ctx, userId)
+	if err != nil {
+		s.log(ctx).Debug("deleteUser: stmt.Exec failed", zap.String("user_id", userId), zap.Error(err))
+		return err
+	}
+	return checkAffectedUser(result, userId)
+}
+
+// checkAffectedUser is NOT_FOUND when a statement by user id has not changed any row
+func checkAffectedUser(result sql.Result, userId string) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errorhandler.NewUserNotFoundError(userId)
+	}
 	return nil
 }
 
-func deleteItem(tx *sql.Tx, userId string) error {
-	stmt, err := tx.Prepare(DeleteItemQuery)
+func (s *Storage) deleteItem(ctx context.Context, tx *sql.Tx, userId string) error {
+	stmt, err := prepare(ctx, tx, "DeleteItemQuery", DeleteItemQuery)
 	if err != nil {
-		errorhandler.LogMsg(fmt.Sprintf("deleteItem: tx.Prepare(%s)", DeleteItemQuery))
+		s.log(ctx).Debug("deleteItem: tx.Prepare failed", zap.String("query", DeleteItemQuery), zap.Error(err))
 		return err
 	}
 	defer stmt.Close()
-	_, err = stmt.Exec(userId)
+	_, err = stmt.ExecContext(ctx, userId)
 	if err != nil {
-		errorhandler.LogMsg(fmt.Sprintf("deleteItem: stmtItem.Exec(%s)", userId))
+		s.log(ctx).Debug("deleteItem: stmt.Exec failed", zap.String("user_id", userId), zap.Error(err))
 		return err
 	}
 	return nil
 }
 
-func ListUser(data *api.ListUserRequest) (*api.ListUserResponse, error) {
-	rows, err := StorageInstance.DB.Query(SelectUsersQuery,
-		data.GetPageFilter().GetLimit(),
-		data.GetPageFilter().GetLimit()*(data.GetPageFilter().GetPage()-1))
+// ListUser reads the page and count of users in a single snapshot, so page contents match total_size
+func (s *Storage) ListUser(ctx context.Context, data *api.ListUserRequest) (*api.ListUserResponse, error) {
+	order, token, err := pagination.ParseRequest(data)
+	if err != nil {
+		return nil, errorhandler.NewInvalidArgumentError(err.Error())
+	}
+	expr, err := filterexpr.Parse(data.GetFilter())
 	if err != nil {
-		errorhandler.LogMsg(fmt.Sprintf("ListUser: StorageInstance.DB.Query(%v, %s)", SelectUserQuery, data.GetPageFilter()))
-		return nil, errorhandler.NewInternalError(err.Error())
+		return nil, errorhandler.NewInvalidArgumentError(err.Error())
+	}
+	var limit uint32
+	if data.GetPageFilter() != nil {
+		limit = data.GetPageFilter().GetLimit()
+	} else {
+		limit = pagination.PageSize(data.GetPageSize())
+	}
+
+	tx, err := s.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		s.log(ctx).Debug("ListUser: s.DB.BeginTx failed", zap.Error(err))
+		return nil, errorhandler.FromError(err)
+	}
+	defer tx.Rollback()
+
+	totalSize, usersBefore, err := s.countUsers(ctx, tx, data, expr, order, token)
+	if err != nil {
+		s.log(ctx).Debug("ListUser: countUsers failed", zap.Error(err))
+		return nil, errorhandler.FromError(err)
+	}
+	response := &api.ListUserResponse{TotalSize: int32(totalSize)}
+
+	// one more user is requested to find out whether the page is the last one
+	var rows *tracedRows
+	pageQuery := newUserListQuery(data.GetUserFilter(), expr, data.GetIncludeDeleted())
+	if data.GetPageFilter() != nil {
+		response.Page = data.GetPageFilter().GetPage()
+		query := fmt.Sprintf(SelectUsersQuery, pageQuery.whereClause(), orderClause(order),
+			pageQuery.arg(int64(limit)+1), pageQuery.arg(int64(limit)*int64(data.GetPageFilter().GetPage()-1)), orderClause(order))
+		rows, err = queryRows(ctx, tx, "SelectUsersQuery", query, pageQuery.args...)
+	} else {
+		response.Page = uint32(usersBefore/int64(limit)) + 1
+		if token.AfterId != "" {
+			after, err := pageQuery.after(order, token)
+			if err != nil {
+				return nil, errorhandler.NewInvalidArgumentError(err.Error())
+			}
+			pageQuery.conditions = append(pageQuery.conditions, after)
+		}
+		query := fmt.Sprintf(SelectUsersAfterQuery, pageQuery.whereClause(), orderClause(order),
+			pageQuery.arg(limit+1), orderClause(order))
+		rows, err = queryRows(ctx, tx, "SelectUsersAfterQuery", query, pageQuery.args...)
+	}
+	if err != nil {
+		s.log(ctx).Debug("ListUser: queryRows failed",
+			zap.Stringer("page_filter", data.GetPageFilter()), zap.String("page_token", data.GetPageToken()), zap.Error(err))
+		return nil, errorhandler.FromError(err)
 	}
 	defer rows.Close()
-	users, err := retrieveUsers(rows)
+	users, err := s.retrieveUsers(ctx, rows)
+	if err != nil {
+		return nil, errorhandler.FromError(err)
+	}
+	if len(users) > int(limit) {
+		users = users[:limit]
+		response.HasMore = true
+		response.NextPageToken = pagination.NextToken(data, order, users[len(users)-1]).Encode()
+	}
+	response.Users = users
+	return response, nil
+}
+
+// countUsers returns count of users matching filters of data and expr and count of them preceding the page token
+func (s *Storage) countUsers(ctx context.Context, tx *sql.Tx, data *api.ListUserRequest, expr filterexpr.Expr,
+	order pagination.Order, token pagination.Token) (int64, int64, error) {
+	countQuery := newUserListQuery(data.GetUserFilter(), expr, data.GetIncludeDeleted())
+	before := "false"
+	if token.AfterId != "" {
+		after, err := countQuery.after(order, token)
+		if err != nil {
+			return 0, 0, err
+		}
+		before = "not (" + after + ")"
+	}
+	query := fmt.Sprintf(CountUsersQuery, before, countQuery.whereClause())
+	rows, err := queryRows(ctx, tx, "CountUsersQuery", query, countQuery.args...)
 	if err != nil {
-		errorhandler.LogMsg(fmt.Sprintf("ListUser: retrieveUsers(rows), error = %v", err))
-		return nil, errorhandler.NewInternalError(err.Error())
+		return 0, 0, err
+	}
+	defer rows.Close()
+	var totalSize, usersBefore int64
+	if rows.Next() {
+		if err := rows.Scan(&totalSize, &usersBefore); err != nil {
+			return 0, 0, err
+		}
 	}
-	return &api.ListUserResponse{Users: users}, nil
+	return totalSize, usersBefore, rows.Err()
 }
 
-func GetUser(data *api.GetUserRequest) (*api.User, error) {
-	return getUserById(data.GetId())
+func (s *Storage) GetUser(ctx context.Context, id entityid.ID) (*api.User, error) {
+	return s.getUserById(ctx, s.DB, id.String())
 }
 
-func getUserById(userId string) (*api.User, error) {
+// getUserById reads not deleted user with its items by db, which is *sql.DB or transaction of the caller
+func (s *Storage) getUserById(ctx context.Context, db queryer, userId string) (*api.User, error) {
 	var user *api.User = nil
-	rows, err := StorageInstance.DB.Query(SelectUserQuery, userId)
+	rows, err := queryRows(ctx, db, "SelectUserQuery", SelectUserQuery, userId)
 	if err != nil {
-		errorhandler.LogMsg(fmt.Sprintf("GetUser: StorageInstance.DB.Query(%v, %s)", SelectUserQuery, userId))
-		return nil, errorhandler.NewInternalError(err.Error())
+		s.log(ctx).Debug("getUserById: queryRows failed", zap.String("user_id", userId), zap.Error(err))
+		return nil, errorhandler.FromError(err)
 	}
-	users, err := retrieveUsers(rows)
+	users, err := s.retrieveUsers(ctx, rows)
 	if err != nil {
-		errorhandler.LogMsg(fmt.Sprintf("GetUser: retrieveUsers(rows), error = %v", err))
-		return nil, errorhandler.NewInternalError(err.Error())
+		return nil, errorhandler.FromError(err)
 	}
 	if len(users) == 1 {
 		user = users[0]
 		err = nil
 	} else if len(users) == 0 {
-		msg := fmt.Sprintf("GetUser: User not found by id = %s", userId)
-		errorhandler.LogMsg(msg)
-		err = errorhandler.NewNotFoundError(msg)
+		err = errorhandler.NewUserNotFoundError(userId)
 	} else if len(users) > 1 {
-		msg := fmt.Sprintf("GetUser: There are more than 1 user by id %s", userId)
-		errorhandler.LogMsg(msg)
+		msg := fmt.Sprintf("There are more than 1 user by id %s", userId)
 		err = errorhandler.NewInternalError(msg)
 	}
 	return user, err
 }
 
-func retrieveUsers(rows *sql.Rows) ([]*api.User, error) {
+// retrieveUsers keeps order of rows, items of a user are joined into rows following each other
+func (s *Storage) retrieveUsers(ctx context.Context, rows *tracedRows) ([]*api.User, error) {
+	var users = make([]*api.User, 0)
 	var userIdToUser = make(map[string]*api.User, 0)
 	defer rows.Close()
 	for rows.Next() {
@@ -405,16 +724,17 @@ func retrieveUsers(rows *sql.Rows) ([]*api.User, error) {
 			userType      api.UserType
 			userCreatedAt time.Time
 			userUpdatedAt pq.NullTime
+			userVersion   int64
+			userDeletedAt pq.NullTime
 			itemId        sql.NullString
 			itemName      sql.NullString
 			itemCreatedAt pq.NullTime
 			itemUpdatedAt pq.NullTime
 		)
-		if err := rows.Scan(&userId, &userName, &userAge, &userType, &userCreatedAt, &userUpdatedAt, &itemId, &itemName, &itemCreatedAt, &itemUpdatedAt); err != nil {
-			errorhandler.LogMsg(fmt.Sprintf("GetUser: StorageInstance.DB.Query(%v, %s)", SelectUserQuery, userId))
-			return nil, errorhandler.NewInternalError(err.Error())
+		if err := rows.Scan(&userId, &userName, &userAge, &userType, &userCreatedAt, &userUpdatedAt, &userVersion, &userDeletedAt, &itemId, &itemName, &itemCreatedAt, &itemUpdatedAt); err != nil {
+			s.log(ctx).Debug("retrieveUsers: rows.Scan failed", zap.Error(err))
+			return nil, errorhandler.FromError(err)
 		}
-
 		if userIdToUser[userId] == nil {
 			user := &api.User{
 				Id:        userId,
@@ -422,8 +742,11 @@ func retrieveUsers(rows *sql.Rows) ([]*api.User, error) {
 				Age:       userAge,
 				UserType:  userType,
 				CreatedAt: timestamppb.New(userCreatedAt),
-				UpdatedAt: getTimestamp(userUpdatedAt)}
+				UpdatedAt: getTimestamp(userUpdatedAt),
+				Version:   userVersion,
+				DeletedAt: getTimestamp(userDeletedAt)}
 			userIdToUser[userId] = user
+			users = append(users, user)
 		}
 		if userIdToUser[userId] != nil && itemId.Valid && itemName.Valid {
 			item := &api.Item{
@@ -435,12 +758,6 @@ func retrieveUsers(rows *sql.Rows) ([]*api.User, error) {
 			userIdToUser[userId].Items = append(userIdToUser[userId].Items, item)
 		}
 	}
-
-	var users = make([]*api.User, 0, len(userIdToUser))
-	for _, value := range userIdToUser {
-		users = append(users, value)
-	}
-
 	return users, nil
 }
 
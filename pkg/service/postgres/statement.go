@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"github.com/fev0ks/UserServiceSC/pkg/service/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedStmt is a prepared statement, every execution of it is traced as span named by query name
+type tracedStmt struct {
+	*sql.Stmt
+	name  string
+	query string
+}
+
+// prepare creates traced statement in tx, failed preparation is traced as well
+func prepare(ctx context.Context, tx *sql.Tx, name string, query string) (*tracedStmt, error) {
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		_, span := tracing.StartQuerySpan(ctx, name, query)
+		tracing.EndQuerySpan(span, 0, err)
+		return nil, err
+	}
+	return &tracedStmt{Stmt: stmt, name: name, query: query}, nil
+}
+
+func (s *tracedStmt) ExecContext(ctx context.Context, args ...interface{}) (sql.Result, error) {
+	ctx, span := tracing.StartQuerySpan(ctx, s.name, s.query)
+	result, err := s.Stmt.ExecContext(ctx, args...)
+	var rowsAffected int64
+	if err == nil {
+		rowsAffected, _ = result.RowsAffected()
+	}
+	tracing.EndQuerySpan(span, rowsAffected, err)
+	return result, err
+}
+
+func (s *tracedStmt) QueryContext(ctx context.Context, args ...interface{}) (*tracedRows, error) {
+	ctx, span := tracing.StartQuerySpan(ctx, s.name, s.query)
+	rows, err := s.Stmt.QueryContext(ctx, args...)
+	return newTracedRows(span, rows, err)
+}
+
+func (s *tracedStmt) QueryRowContext(ctx context.Context, args ...interface{}) *tracedRow {
+	ctx, span := tracing.StartQuerySpan(ctx, s.name, s.query)
+	return &tracedRow{Row: s.Stmt.QueryRowContext(ctx, args...), span: span}
+}
+
+// queryer is *sql.DB or *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// queryRows runs SELECT statement without preparation
+func queryRows(ctx context.Context, db queryer, name string, query string, args ...interface{}) (*tracedRows, error) {
+	ctx, span := tracing.StartQuerySpan(ctx, name, query)
+	rows, err := db.QueryContext(ctx, query, args...)
+	return newTracedRows(span, rows, err)
+}
+
+// tracedRows counts returned rows, span of the query is ended once rows are closed
+type tracedRows struct {
+	*sql.Rows
+	span  trace.Span
+	count int64
+	ended bool
+}
+
+func newTracedRows(span trace.Span, rows *sql.Rows, err error) (*tracedRows, error) {
+	if err != nil {
+		tracing.EndQuerySpan(span, 0, err)
+		return nil, err
+	}
+	return &tracedRows{Rows: rows, span: span}, nil
+}
+
+func (r *tracedRows) Next() bool {
+	if r.Rows.Next() {
+		r.count++
+		return true
+	}
+	return false
+}
+
+func (r *tracedRows) Close() error {
+	err := r.Rows.Close()
+	if !r.ended {
+		r.ended = true
+		if err == nil {
+			err = r.Rows.Err()
+		}
+		tracing.EndQuerySpan(r.span, r.count, err)
+	}
+	return err
+}
+
+// tracedRow ends span of the query once row is scanned
+type tracedRow struct {
+	*sql.Row
+	span trace.Span
+}
+
+func (r *tracedRow) Scan(dest ...interface{}) error {
+	err := r.Row.Scan(dest...)
+	switch err {
+	case nil:
+		tracing.EndQuerySpan(r.span, 1, nil)
+	case sql.ErrNoRows:
+		tracing.EndQuerySpan(r.span, 0, nil)
+	default:
+		tracing.EndQuerySpan(r.span, 0, err)
+	}
+	return err
+}
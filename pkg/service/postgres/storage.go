@@ -1,13 +1,26 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
+	"github.com/fev0ks/UserServiceSC/pkg/service/logging"
+	"go.uber.org/zap"
 )
 
 type Storage struct {
-	DB *sql.DB
+	DB     *sql.DB
+	logger *zap.Logger
 }
 
-func NewStorage(db *sql.DB) *Storage {
-	return &Storage{db}
+func NewStorage(db *sql.DB, logger *zap.Logger) *Storage {
+	return &Storage{DB: db, logger: logger}
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.DB.PingContext(ctx)
+}
+
+// log returns logger with request scoped fields of ctx
+func (s *Storage) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, s.logger)
 }
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"context"
+	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"github.com/fev0ks/UserServiceSC/pkg/service/entityid"
+)
+
+// UserRepository is a storage backend used by GRPCServer to persist users and their items.
+// Ids are parsed by GRPCServer, so ids of requests which are passed along with parsed ones are not read again
+type UserRepository interface {
+	CreateUser(ctx context.Context, data *api.CreateUserRequest) (*api.User, error)
+	GetUser(ctx context.Context, id entityid.ID) (*api.User, error)
+	UpdateUser(ctx context.Context, id entityid.ID, data *api.UpdateUserRequest) (*api.User, error)
+	DeleteUser(ctx context.Context, id entityid.ID, data *api.DeleteUserRequest) (*api.DeleteUserResponse, error)
+	ListUser(ctx context.Context, data *api.ListUserRequest) (*api.ListUserResponse, error)
+	RestoreUser(ctx context.Context, id entityid.ID, data *api.RestoreUserRequest) (*api.User, error)
+	PurgeUser(ctx context.Context, id entityid.ID, data *api.PurgeUserRequest) (*api.PurgeUserResponse, error)
+	AddItems(ctx context.Context, userId entityid.ID, data *api.AddItemsRequest) (*api.AddItemsResponse, error)
+	RemoveItems(ctx context.Context, userId entityid.ID, itemIds []entityid.ID) (*api.RemoveItemsResponse, error)
+	GetItem(ctx context.Context, id entityid.ID) (*api.Item, error)
+	// ListItems lists items of every user when userId is zero
+	ListItems(ctx context.Context, userId entityid.ID, data *api.ListItemsRequest) (*api.ListItemsResponse, error)
+}
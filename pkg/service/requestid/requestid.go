@@ -0,0 +1,70 @@
+package requestid
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// MetadataKey is a metadata key of the request id in both incoming requests and responses
+const MetadataKey = "x-request-id"
+
+// maxLength limits length of request id taken from client, longer ids are replaced by generated one
+const maxLength = 128
+
+type contextKey struct{}
+
+func NewContext(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, contextKey{}, requestId)
+}
+
+// FromContext returns request id of ctx or empty string if ctx does not carry it
+func FromContext(ctx context.Context) string {
+	requestId, _ := ctx.Value(contextKey{}).(string)
+	return requestId
+}
+
+// UnaryServerInterceptor takes request id from incoming metadata or generates a new one, puts it into the context
+// and returns it to client in response header and trailer, request id is added to details of returned error
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		requestId := fromIncomingMetadata(ctx)
+		if requestId == "" {
+			requestId = uuid.NewString()
+		}
+		md := metadata.Pairs(MetadataKey, requestId)
+		_ = grpc.SetHeader(ctx, md)
+		_ = grpc.SetTrailer(ctx, md)
+
+		resp, err := handler(NewContext(ctx, requestId), req)
+		if err != nil {
+			return resp, withRequestInfo(err, requestId)
+		}
+		return resp, nil
+	}
+}
+
+func fromIncomingMetadata(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(MetadataKey)
+	if len(values) == 0 || len(values[0]) > maxLength {
+		return ""
+	}
+	return values[0]
+}
+
+// withRequestInfo adds google.rpc.RequestInfo detail to status of err, message and code are kept as is
+func withRequestInfo(err error, requestId string) error {
+	st := status.Convert(err)
+	withDetails, detailsErr := st.WithDetails(&errdetails.RequestInfo{RequestId: requestId})
+	if detailsErr != nil {
+		return err
+	}
+	return withDetails.Err()
+}
@@ -0,0 +1,42 @@
+package requestid
+
+import (
+	"context"
+	"github.com/fev0ks/UserServiceSC/pkg/service/errorhandler"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+var info = &grpc.UnaryServerInfo{FullMethod: "/user_service_sc.UserService/GetUser"}
+
+func TestUnaryServerInterceptor_shouldUseIncomingRequestId(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataKey, "test-request-id"))
+	var handledRequestId string
+
+	_, err := UnaryServerInterceptor()(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		handledRequestId = FromContext(ctx)
+		return nil, nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "test-request-id", handledRequestId)
+}
+
+func TestUnaryServerInterceptor_shouldGenerateRequestId_whenItIsMissed(t *testing.T) {
+	var handledRequestId string
+
+	_, err := UnaryServerInterceptor()(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		handledRequestId = FromContext(ctx)
+		return nil, errorhandler.NewNotFoundError("GetUser: User not found by id = 42")
+	})
+
+	assert.NotEmpty(t, handledRequestId)
+	st := status.Convert(err)
+	assert.Equal(t, "GetUser: User not found by id = 42", st.Message())
+	assert.Equal(t, 1, len(st.Details()))
+	assert.Equal(t, handledRequestId, st.Details()[0].(*errdetails.RequestInfo).RequestId)
+}
@@ -0,0 +1,12 @@
+package rpcmethod
+
+import "strings"
+
+// Split splits gRPC full method name "/package.Service/Method" into service and method names
+func Split(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.Index(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", fullMethod
+}
@@ -0,0 +1,82 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"github.com/fev0ks/UserServiceSC/pkg/service/errorhandler"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"testing"
+)
+
+const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+var info = &grpc.UnaryServerInfo{FullMethod: "/user_service_sc.UserService/CreateUser"}
+
+func newTestProvider() (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	return sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)), exporter
+}
+
+func attributeOf(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestUnaryServerInterceptor_shouldTraceRPCAndQueries(t *testing.T) {
+	provider, exporter := newTestProvider()
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", traceParent))
+
+	_, err := UnaryServerInterceptor(provider, Propagator())(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		_, span := StartQuerySpan(ctx, "InsertUserQuery", "INSERT INTO \"user\"(name, age) VALUES($1, $2)")
+		EndQuerySpan(span, 1, nil)
+		_, span = StartQuerySpan(ctx, "InsertItemQuery", "INSERT INTO \"item\"(name) VALUES ($1)")
+		EndQuerySpan(span, 0, errors.New("connection reset"))
+		return nil, errorhandler.NewInternalError("connection reset")
+	})
+
+	assert.Error(t, err)
+	spans := exporter.GetSpans()
+	if !assert.Equal(t, 3, len(spans)) {
+		return
+	}
+	insertUser, insertItem, rpc := spans[0], spans[1], spans[2]
+
+	assert.Equal(t, "user_service_sc.UserService/CreateUser", rpc.Name)
+	assert.Equal(t, trace.SpanKindServer, rpc.SpanKind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", rpc.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", rpc.Parent.SpanID().String())
+	assert.Equal(t, "CreateUser", attributeOf(rpc, "rpc.method").AsString())
+	assert.Equal(t, int64(13), attributeOf(rpc, "rpc.grpc.status_code").AsInt64())
+	assert.Equal(t, otelcodes.Error, rpc.Status.Code)
+
+	assert.Equal(t, "InsertUserQuery", insertUser.Name)
+	assert.Equal(t, trace.SpanKindClient, insertUser.SpanKind)
+	assert.Equal(t, rpc.SpanContext.SpanID(), insertUser.Parent.SpanID())
+	assert.Equal(t, "postgresql", attributeOf(insertUser, "db.system").AsString())
+	assert.Equal(t, int64(1), attributeOf(insertUser, RowsAttributeKey).AsInt64())
+	assert.Equal(t, otelcodes.Unset, insertUser.Status.Code)
+
+	assert.Equal(t, "InsertItemQuery", insertItem.Name)
+	assert.Equal(t, rpc.SpanContext.SpanID(), insertItem.Parent.SpanID())
+	assert.Equal(t, otelcodes.Error, insertItem.Status.Code)
+	assert.Equal(t, "connection reset", insertItem.Status.Description)
+}
+
+func TestStartQuerySpan_shouldNotRecord_outsideOfRPC(t *testing.T) {
+	_, span := StartQuerySpan(context.Background(), "SelectUserQuery", "SELECT 1")
+	EndQuerySpan(span, 1, nil)
+
+	assert.False(t, span.IsRecording())
+	assert.False(t, span.SpanContext().IsValid())
+}
@@ -0,0 +1,64 @@
+package updatemask
+
+import (
+	"fmt"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// paths of UpdateUserRequest which may be used in update_mask
+const (
+	NamePath     = "name"
+	AgePath      = "age"
+	UserTypePath = "user_type"
+	// ItemsPath replaces items: items without id are created, owned items missing in the request are deleted
+	ItemsPath = "items"
+	// ItemNamesPath renames items of the request only
+	ItemNamesPath = "items.name"
+	// WildcardPath replaces every field like a missing mask
+	WildcardPath = "*"
+)
+
+// UserMask is parsed update_mask of UpdateUser
+type UserMask struct {
+	Name      bool
+	Age       bool
+	UserType  bool
+	Items     bool
+	ItemNames bool
+}
+
+// All replaces every field of a user
+var All = UserMask{Name: true, Age: true, UserType: true, Items: true}
+
+// ParseUserMask parses update_mask, missing or empty mask updates every field
+func ParseUserMask(mask *fieldmaskpb.FieldMask) (UserMask, error) {
+	if len(mask.GetPaths()) == 0 {
+		return All, nil
+	}
+	var userMask UserMask
+	for _, path := range mask.GetPaths() {
+		switch path {
+		case WildcardPath:
+			if len(mask.GetPaths()) > 1 {
+				return UserMask{}, fmt.Errorf("update_mask path '%s' must not be used with other paths", WildcardPath)
+			}
+			return All, nil
+		case NamePath:
+			userMask.Name = true
+		case AgePath:
+			userMask.Age = true
+		case UserTypePath:
+			userMask.UserType = true
+		case ItemsPath:
+			userMask.Items = true
+		case ItemNamesPath:
+			userMask.ItemNames = true
+		default:
+			return UserMask{}, fmt.Errorf("update_mask path '%s' is not supported", path)
+		}
+	}
+	if userMask.Items && userMask.ItemNames {
+		return UserMask{}, fmt.Errorf("update_mask paths '%s' and '%s' must not be used together", ItemsPath, ItemNamesPath)
+	}
+	return userMask, nil
+}
@@ -0,0 +1,40 @@
+package updatemask
+
+import (
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"testing"
+)
+
+func TestParseUserMask(t *testing.T) {
+	testCases := []struct {
+		caseName string
+		mask     *fieldmaskpb.FieldMask
+		result   UserMask
+		errMsg   string
+	}{
+		{caseName: "missing mask", mask: nil, result: All},
+		{caseName: "empty mask", mask: &fieldmaskpb.FieldMask{}, result: All},
+		{caseName: "wildcard", mask: &fieldmaskpb.FieldMask{Paths: []string{"*"}}, result: All},
+		{caseName: "name", mask: &fieldmaskpb.FieldMask{Paths: []string{"name"}}, result: UserMask{Name: true}},
+		{caseName: "age and user_type", mask: &fieldmaskpb.FieldMask{Paths: []string{"age", "user_type"}}, result: UserMask{Age: true, UserType: true}},
+		{caseName: "items", mask: &fieldmaskpb.FieldMask{Paths: []string{"items"}}, result: UserMask{Items: true}},
+		{caseName: "item names", mask: &fieldmaskpb.FieldMask{Paths: []string{"items.name"}}, result: UserMask{ItemNames: true}},
+		{caseName: "items and item names", mask: &fieldmaskpb.FieldMask{Paths: []string{"items", "items.name"}}, errMsg: "update_mask paths 'items' and 'items.name' must not be used together"},
+		{caseName: "unknown path", mask: &fieldmaskpb.FieldMask{Paths: []string{"created_at"}}, errMsg: "update_mask path 'created_at' is not supported"},
+		{caseName: "unknown item path", mask: &fieldmaskpb.FieldMask{Paths: []string{"items.id"}}, errMsg: "update_mask path 'items.id' is not supported"},
+		{caseName: "wildcard with other paths", mask: &fieldmaskpb.FieldMask{Paths: []string{"*", "name"}}, errMsg: "update_mask path '*' must not be used with other paths"},
+	}
+	for i := range testCases {
+		tc := &testCases[i]
+		t.Run(tc.caseName, func(t *testing.T) {
+			result, err := ParseUserMask(tc.mask)
+			if tc.errMsg == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.result, result)
+			} else {
+				assert.EqualError(t, err, tc.errMsg)
+			}
+		})
+	}
+}
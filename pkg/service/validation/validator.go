@@ -4,6 +4,16 @@ import (
 	"errors"
 	"fmt"
 	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"github.com/fev0ks/UserServiceSC/pkg/service/entityid"
+	"github.com/fev0ks/UserServiceSC/pkg/service/filterexpr"
+	"github.com/fev0ks/UserServiceSC/pkg/service/pagination"
+	"github.com/fev0ks/UserServiceSC/pkg/service/updatemask"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"strconv"
+	"strings"
 )
 
 type AgeData interface {
@@ -18,6 +28,10 @@ type IdData interface {
 	GetId() string
 }
 
+type UserIdData interface {
+	GetUserId() string
+}
+
 type CreateUserData interface {
 	AgeData
 	NameData
@@ -29,6 +43,7 @@ type UserData interface {
 	NameData
 	IdData
 	GetItems() []*api.UpdateItemRequest
+	GetUpdateMask() *fieldmaskpb.FieldMask
 }
 
 type NewItemData interface {
@@ -44,6 +59,21 @@ type PageFilterData interface {
 	GetPageFilter() *api.PageFilter
 }
 
+type ListUserData interface {
+	PageFilterData
+	pagination.Request
+}
+
+type AddItemsData interface {
+	UserIdData
+	GetItems() []*api.CreateItemRequest
+}
+
+type RemoveItemsData interface {
+	UserIdData
+	GetItemIds() []string
+}
+
 func ValidateCreateUserRequestData(userData CreateUserData) error {
 	if err := ValidateAge(userData); err != nil {
 		return createUserValidationErrorFmt(userData, err)
@@ -53,36 +83,117 @@ func ValidateCreateUserRequestData(userData CreateUserData) error {
 	}
 	for _, item := range userData.GetItems() {
 		if err := validateCreateItemRequestData(item); err != nil {
-			return errors.New(fmt.Sprintf("Item validation failed: item - '%v', err - %v", item.String(), err.Error()))
+			return errors.New(fmt.Sprintf("Item validation failed: item - '%v', err - %v", compact(item), err.Error()))
 		}
 	}
 	return nil
 }
 
-func ValidateUserRequestData(userData UserData) error {
-	if err := ValidateId(userData); err != nil {
-		return userValidationErrorFmt(userData, err)
+// ValidateUserRequestData validates fields of update_mask, every field is validated when mask is not set,
+// parsed id of the user is returned
+func ValidateUserRequestData(userData UserData) (entityid.ID, error) {
+	id, err := ParseId(userData)
+	if err != nil {
+		return entityid.ID{}, userValidationErrorFmt(userData, err)
 	}
-	if err := ValidateAge(userData); err != nil {
-		return userValidationErrorFmt(userData, err)
+	mask, err := updatemask.ParseUserMask(userData.GetUpdateMask())
+	if err != nil {
+		return entityid.ID{}, userValidationErrorFmt(userData, err)
 	}
-	if err := ValidateName(userData); err != nil {
-		return userValidationErrorFmt(userData, err)
+	if mask.Age {
+		if err := ValidateAge(userData); err != nil {
+			return entityid.ID{}, userValidationErrorFmt(userData, err)
+		}
+	}
+	if mask.Name {
+		if err := ValidateName(userData); err != nil {
+			return entityid.ID{}, userValidationErrorFmt(userData, err)
+		}
 	}
+	if !mask.Items && !mask.ItemNames {
+		return id, nil
+	}
+	itemIds := make(map[string]bool, len(userData.GetItems()))
 	for _, item := range userData.GetItems() {
-		if err := validateItemRequestData(item); err != nil {
-			return errors.New(fmt.Sprintf("Item validation failed: item - '%v', err - '%v'", item.String(), err.Error()))
+		if err := validateUpdateItemRequestData(item, mask.ItemNames); err != nil {
+			return entityid.ID{}, errors.New(fmt.Sprintf("Item validation failed: item - '%v', err - '%v'", compact(item), err.Error()))
+		}
+		if item.GetId() != "" && itemIds[item.GetId()] {
+			return entityid.ID{}, errors.New(fmt.Sprintf("Item validation failed: item - '%v', err - 'id is duplicated'", compact(item)))
 		}
+		itemIds[item.GetId()] = true
 	}
-	return nil
+	return id, nil
+}
+
+// validateUpdateItemRequestData requires id only for renaming, item without id is created by items replacement
+func validateUpdateItemRequestData(itemData ItemData, rename bool) error {
+	if rename {
+		return validateItemRequestData(itemData)
+	}
+	if itemData.GetId() != "" {
+		if err := ValidateId(itemData); err != nil {
+			return err
+		}
+	}
+	return ValidateName(itemData)
 }
 
 func userValidationErrorFmt(userData UserData, err error) error {
-	return errors.New(fmt.Sprintf("User validation failed: user - '%v', err - %v", userData, err.Error()))
+	return errors.New(fmt.Sprintf("User validation failed: user - '%v', err - %v", compact(userData), err.Error()))
 }
 
 func createUserValidationErrorFmt(userData CreateUserData, err error) error {
-	return errors.New(fmt.Sprintf("User validation failed: user - '%v', err - %v", userData, err.Error()))
+	return errors.New(fmt.Sprintf("User validation failed: user - '%v', err - %v", compact(userData), err.Error()))
+}
+
+// compact formats message in a single line like `name:"John  Smith" items:{id:"1"}`, protobuf String() and
+// prototext randomly add spaces between fields, so set fields are written in declaration order here
+func compact(value interface{}) string {
+	message, ok := value.(proto.Message)
+	if !ok {
+		return fmt.Sprintf("%v", value)
+	}
+	return compactMessage(message.ProtoReflect())
+}
+
+func compactMessage(message protoreflect.Message) string {
+	parts := make([]string, 0)
+	fields := message.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if !message.Has(field) {
+			continue
+		}
+		value := message.Get(field)
+		if field.IsList() {
+			list := value.List()
+			for j := 0; j < list.Len(); j++ {
+				parts = append(parts, fmt.Sprintf("%s:%s", field.Name(), compactValue(field, list.Get(j))))
+			}
+		} else if !field.IsMap() {
+			parts = append(parts, fmt.Sprintf("%s:%s", field.Name(), compactValue(field, value)))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func compactValue(field protoreflect.FieldDescriptor, value protoreflect.Value) string {
+	switch field.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return "{" + compactMessage(value.Message()) + "}"
+	case protoreflect.EnumKind:
+		if enumValue := field.Enum().Values().ByNumber(value.Enum()); enumValue != nil {
+			return string(enumValue.Name())
+		}
+		return strconv.Itoa(int(value.Enum()))
+	case protoreflect.StringKind:
+		return strconv.Quote(value.String())
+	case protoreflect.BytesKind:
+		return strconv.Quote(string(value.Bytes()))
+	default:
+		return fmt.Sprintf("%v", value.Interface())
+	}
 }
 
 func validateCreateItemRequestData(itemDate NewItemData) error {
@@ -103,10 +214,82 @@ func validateItemRequestData(itemData ItemData) error {
 }
 
 func ValidateId(idData IdData) error {
-	if idData.GetId() == "" {
-		return errors.New("id is missed")
+	_, err := ParseId(idData)
+	return err
+}
+
+// ParseId parses id of the request, so storage gets the id which is known to be well formed
+func ParseId(idData IdData) (entityid.ID, error) {
+	return parseId("id", idData.GetId())
+}
+
+func ParseUserId(userIdData UserIdData) (entityid.ID, error) {
+	return parseId("user_id", userIdData.GetUserId())
+}
+
+// parseId rejects malformed id of the field before it reaches a storage
+func parseId(field string, value string) (entityid.ID, error) {
+	id, err := entityid.Parse(value)
+	if err == entityid.ErrIdIsMissed {
+		return id, fmt.Errorf("%s is missed", field)
 	}
-	return nil
+	if err != nil {
+		return id, fmt.Errorf("%s is malformed: %v", field, err)
+	}
+	return id, nil
+}
+
+// ValidateAddItemsRequestData validates new items and returns parsed id of their user
+func ValidateAddItemsRequestData(addItemsData AddItemsData) (entityid.ID, error) {
+	userId, err := ParseUserId(addItemsData)
+	if err != nil {
+		return userId, err
+	}
+	if len(addItemsData.GetItems()) == 0 {
+		return entityid.ID{}, errors.New("items are missed")
+	}
+	for _, item := range addItemsData.GetItems() {
+		if err := validateCreateItemRequestData(item); err != nil {
+			return entityid.ID{}, errors.New(fmt.Sprintf("Item validation failed: item - '%v', err - %v", compact(item), err.Error()))
+		}
+	}
+	return userId, nil
+}
+
+// ValidateRemoveItemsRequestData returns parsed ids of the user and of removed items
+func ValidateRemoveItemsRequestData(removeItemsData RemoveItemsData) (entityid.ID, []entityid.ID, error) {
+	userId, err := ParseUserId(removeItemsData)
+	if err != nil {
+		return userId, nil, err
+	}
+	if len(removeItemsData.GetItemIds()) == 0 {
+		return entityid.ID{}, nil, errors.New("item_ids are missed")
+	}
+	itemIds := make([]entityid.ID, 0, len(removeItemsData.GetItemIds()))
+	for i, value := range removeItemsData.GetItemIds() {
+		itemId, err := parseId(fmt.Sprintf("item_ids[%d]", i), value)
+		if err != nil {
+			return entityid.ID{}, nil, err
+		}
+		itemIds = append(itemIds, itemId)
+	}
+	return userId, itemIds, nil
+}
+
+// ValidateListItemsRequestData returns parsed user_id, it is zero when items of every user are listed
+func ValidateListItemsRequestData(listItemsData pagination.ItemsRequest) (entityid.ID, error) {
+	var userId entityid.ID
+	if listItemsData.GetUserId() != "" {
+		parsed, err := parseId("user_id", listItemsData.GetUserId())
+		if err != nil {
+			return entityid.ID{}, err
+		}
+		userId = parsed
+	}
+	if _, err := pagination.ParseItemsRequest(listItemsData); err != nil {
+		return entityid.ID{}, err
+	}
+	return userId, nil
 }
 
 //ValidateAge TODO age may be bigger than MAX int32 -> as result age < 0
@@ -124,6 +307,63 @@ func ValidateName(userData NameData) error {
 	return nil
 }
 
+// ValidateListUserRequestData accepts either offset based pageFilter or keyset page_token, not both of them
+func ValidateListUserRequestData(listUserData ListUserData) error {
+	if listUserData.GetPageFilter() != nil {
+		if listUserData.GetPageToken() != "" {
+			return errors.New("page_token and pageFilter must not be used together")
+		}
+		if err := ValidatePageFilter(listUserData); err != nil {
+			return err
+		}
+	}
+	if err := ValidateUserFilter(listUserData.GetUserFilter()); err != nil {
+		return err
+	}
+	if _, err := filterexpr.Parse(listUserData.GetFilter()); err != nil {
+		return err
+	}
+	_, _, err := pagination.ParseRequest(listUserData)
+	return err
+}
+
+func ValidateUserFilter(filter *api.UserFilter) error {
+	if filter == nil {
+		return nil
+	}
+	if _, ok := api.UserType_name[int32(filter.GetUserType())]; !ok {
+		return fmt.Errorf("user_filter.user_type is unknown, user_type = %d", filter.GetUserType())
+	}
+	if filter.MinAge != nil && filter.GetMinAge() < 0 {
+		return fmt.Errorf("user_filter.min_age must not be negative, min_age = %d", filter.GetMinAge())
+	}
+	if filter.MinAge != nil && filter.MaxAge != nil && filter.GetMinAge() > filter.GetMaxAge() {
+		return fmt.Errorf("user_filter.min_age must not be greater than max_age, min_age = %d, max_age = %d",
+			filter.GetMinAge(), filter.GetMaxAge())
+	}
+	if err := validateTimeRange("created", filter.GetCreatedAfter(), filter.GetCreatedBefore()); err != nil {
+		return err
+	}
+	return validateTimeRange("updated", filter.GetUpdatedAfter(), filter.GetUpdatedBefore())
+}
+
+func validateTimeRange(name string, after *timestamppb.Timestamp, before *timestamppb.Timestamp) error {
+	if after != nil {
+		if err := after.CheckValid(); err != nil {
+			return fmt.Errorf("user_filter.%s_after is invalid: %v", name, err)
+		}
+	}
+	if before != nil {
+		if err := before.CheckValid(); err != nil {
+			return fmt.Errorf("user_filter.%s_before is invalid: %v", name, err)
+		}
+	}
+	if after != nil && before != nil && !after.AsTime().Before(before.AsTime()) {
+		return fmt.Errorf("user_filter.%s_after must be before %s_before", name, name)
+	}
+	return nil
+}
+
 //ValidatePageFilter TODO page and limit are uint type if input value = -n then result value = MAX.INT-n ...
 func ValidatePageFilter(pageFilterData PageFilterData) error {
 	if pageFilterData.GetPageFilter() == nil {
@@ -3,6 +3,7 @@ package validation
 import (
 	"fmt"
 	api "github.com/fev0ks/UserServiceSC/pkg/api"
+	"github.com/fev0ks/UserServiceSC/pkg/service/entityid"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -73,6 +74,15 @@ func TestValidateCreateUserRequestData_shouldReturnError_whenRequestIsNotValid(t
 			},
 			expectedErrorMsg: "Item validation failed: item - '', err - name is missed",
 		},
+		{
+			caseName: "Whitespace of name is kept",
+			createUserRequest: &api.CreateUserRequest{
+				Name:     "John  Smith\n",
+				Age:      -1,
+				UserType: api.UserType_EMPLOYEE_USER_TYPE,
+			},
+			expectedErrorMsg: "User validation failed: user - 'name:\"John  Smith\\n\" age:-1 user_type:EMPLOYEE_USER_TYPE', err - age of user must be positive, age = -1",
+		},
 	}
 
 	for _, tc := range validTestCases {
@@ -82,6 +92,128 @@ func TestValidateCreateUserRequestData_shouldReturnError_whenRequestIsNotValid(t
 	}
 }
 
+func TestValidateItemsRequestData(t *testing.T) {
+	testCases := []struct {
+		caseName         string
+		validate         func() error
+		expectedErrorMsg string
+	}{
+		{
+			caseName: "Add items",
+			validate: func() error {
+				_, err := ValidateAddItemsRequestData(&api.AddItemsRequest{UserId: "1", Items: initCreateItemRequest(createItems(2)...)})
+				return err
+			},
+		},
+		{
+			caseName: "Add items, missed user id",
+			validate: func() error {
+				_, err := ValidateAddItemsRequestData(&api.AddItemsRequest{Items: initCreateItemRequest(createItems(1)...)})
+				return err
+			},
+			expectedErrorMsg: "user_id is missed",
+		},
+		{
+			caseName: "Add items, missed items",
+			validate: func() error {
+				_, err := ValidateAddItemsRequestData(&api.AddItemsRequest{UserId: "1"})
+				return err
+			},
+			expectedErrorMsg: "items are missed",
+		},
+		{
+			caseName: "Add items, missed item name",
+			validate: func() error {
+				_, err := ValidateAddItemsRequestData(&api.AddItemsRequest{UserId: "1", Items: initCreateItemRequest(createInvalidItems(1)...)})
+				return err
+			},
+			expectedErrorMsg: "Item validation failed: item - '', err - name is missed",
+		},
+		{
+			caseName: "Remove items",
+			validate: func() error {
+				_, _, err := ValidateRemoveItemsRequestData(&api.RemoveItemsRequest{UserId: "1", ItemIds: []string{"2", "3"}})
+				return err
+			},
+		},
+		{
+			caseName: "Remove items, missed item ids",
+			validate: func() error {
+				_, _, err := ValidateRemoveItemsRequestData(&api.RemoveItemsRequest{UserId: "1"})
+				return err
+			},
+			expectedErrorMsg: "item_ids are missed",
+		},
+		{
+			caseName: "Remove items, empty item id",
+			validate: func() error {
+				_, _, err := ValidateRemoveItemsRequestData(&api.RemoveItemsRequest{UserId: "1", ItemIds: []string{"2", ""}})
+				return err
+			},
+			expectedErrorMsg: "item_ids[1] is missed",
+		},
+		{
+			caseName: "Add items, malformed user id",
+			validate: func() error {
+				_, err := ValidateAddItemsRequestData(&api.AddItemsRequest{UserId: "abc", Items: initCreateItemRequest(createItems(1)...)})
+				return err
+			},
+			expectedErrorMsg: "user_id is malformed: 'abc' is not a valid id",
+		},
+		{
+			caseName: "Remove items, malformed item id",
+			validate: func() error {
+				_, _, err := ValidateRemoveItemsRequestData(&api.RemoveItemsRequest{UserId: "1", ItemIds: []string{"2", "07"}})
+				return err
+			},
+			expectedErrorMsg: "item_ids[1] is malformed: '07' is not a valid id",
+		},
+		{
+			caseName: "Get item, malformed id",
+			validate: func() error {
+				return ValidateId(&api.GetItemRequest{Id: "1; drop table item"})
+			},
+			expectedErrorMsg: "id is malformed: '1; drop table item' is not a valid id",
+		},
+		{
+			caseName: "List items, malformed user id",
+			validate: func() error {
+				_, err := ValidateListItemsRequestData(&api.ListItemsRequest{UserId: "-1"})
+				return err
+			},
+			expectedErrorMsg: "user_id is malformed: '-1' is not a valid id",
+		},
+		{
+			caseName: "List items, invalid page token",
+			validate: func() error {
+				_, err := ValidateListItemsRequestData(&api.ListItemsRequest{PageToken: "%%%"})
+				return err
+			},
+			expectedErrorMsg: "page_token is invalid",
+		},
+	}
+
+	for i := range testCases {
+		tc := &testCases[i]
+		t.Run(tc.caseName, func(t *testing.T) {
+			err := tc.validate()
+			if tc.expectedErrorMsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedErrorMsg)
+			}
+		})
+	}
+}
+
+func TestValidateRemoveItemsRequestData_shouldReturnParsedIds(t *testing.T) {
+	userId, itemIds, err := ValidateRemoveItemsRequestData(&api.RemoveItemsRequest{UserId: "1", ItemIds: []string{"2", "3"}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "1", userId.String())
+	assert.Equal(t, []string{"2", "3"}, entityid.Strings(itemIds))
+}
+
 func TestSomethingElse(t *testing.T) {
 	//etc
 }